@@ -65,7 +65,7 @@ load(
 )
 load(
     "@io_bazel_rules_go//go/private:rules/nogo.bzl",
-    _nogo = "nogo_wrapper",
+    _nogo = "nogo",
 )
 
 # Current version or next version to be tagged. Gazelle and other tools may
@@ -44,14 +44,54 @@ def emit_archive(go, source = None):
     split = split_srcs(source.srcs)
     lib_name = source.library.importmap + ".a"
     out_lib = go.declare_file(go, path = lib_name)
+
+    # Dependent packages are compiled against the header archive, which only
+    # contains export data. out_lib is only needed for linking. The bootstrap
+    # compiler doesn't support this.
+    out_header = None
+    if go.builders:
+        out_header = go.declare_file(go, path = lib_name[:-len(".a")] + ".header.a")
     out_export = None
+    out_vetx = None
+    out_findings = None
+    out_fixes = None
+    out_baseline = None
+    out_profile = None
+    out_cpu_profile = None
     if go.nogo:
         # TODO(#1847): write nogo data into a new section in the .a file instead
         # of writing a separate file.
         out_export = go.declare_file(go, path = lib_name[:-len(".a")] + ".x")
+        out_vetx = go.declare_file(go, path = lib_name[:-len(".a")] + ".vetx")
+        out_findings = go.declare_file(go, path = lib_name[:-len(".a")] + ".nogo.json")
+        if "nogo_fix" in go._ctx.features:
+            out_fixes = go.declare_file(go, path = lib_name[:-len(".a")] + ".nogo.patch")
+        if "nogo_baseline" in go._ctx.features:
+            out_baseline = go.declare_file(go, path = lib_name[:-len(".a")] + ".nogo.baseline")
+        if "nogo_profile" in go._ctx.features:
+            out_profile = go.declare_file(go, path = lib_name[:-len(".a")] + ".nogo.profile.json")
+        if "nogo_cpu_profile" in go._ctx.features:
+            out_cpu_profile = go.declare_file(go, path = lib_name[:-len(".a")] + ".nogo.cpu.pprof")
     searchpath = out_lib.path[:-len(lib_name)]
     testfilter = getattr(source.library, "testfilter", None)
 
+    # Unused dependencies aren't reported for tests. Dependencies of a go_test
+    # are shared by the internal and external test packages and the generated
+    # main package, so each may only use some of them.
+    unused_deps = "off"
+    out_unused_deps = None
+    if testfilter == None and source.library.importmap != "testmain":
+        if "unused_deps_error" in go._ctx.features:
+            unused_deps = "error"
+        elif "unused_deps_warn" in go._ctx.features:
+            unused_deps = "warn"
+        if "unused_deps_output" in go._ctx.features:
+            out_unused_deps = go.declare_file(go, path = lib_name[:-len(".a")] + ".unused_deps.json")
+
+    out_stats = None
+    if "compile_stats" in go._ctx.features:
+        out_stats = go.declare_file(go, path = lib_name[:-len(".a")] + ".compile_stats.json")
+
     direct = [get_archive(dep) for dep in source.deps]
     runfiles = source.runfiles
     data_files = runfiles.files
@@ -62,50 +102,66 @@ def emit_archive(go, source = None):
     if covered:
         direct.append(go.coverdata)
 
+    # Libraries that provide each import path among transitive dependencies.
+    # These are suggested when a source imports a package that isn't a direct
+    # dependency.
+    deps_index = depset(transitive = [a.transitive for a in direct])
+    out_deps_index = None
+    if go.builders:
+        out_deps_index = go.declare_file(go, path = lib_name[:-len(".a")] + ".deps_index")
+
     asmhdr = None
     if split.asm:
         asmhdr = go.declare_file(go, "go_asm.h")
 
-    if len(split.asm) == 0 and not source.cgo_archives:
-        go.compile(
-            go,
-            sources = split.go,
-            importpath = source.library.importmap,
-            archives = direct,
-            out_lib = out_lib,
-            out_export = out_export,
-            gc_goopts = source.gc_goopts,
-            testfilter = testfilter,
-        )
-    else:
-        # Assembly files must be passed to the compiler as sources. We need
-        # to run the assembler to produce a symabis file that gets passed to
-        # the compiler. The compiler builder does all this so it doesn't
-        # need to be a separate action (but individual .o files are still
-        # produced with separate actions).
-        partial_lib = go.declare_file(go, path = lib_name + "~partial", ext = ".a")
-        go.compile(
-            go,
-            sources = split.go + split.asm + split.headers,
-            importpath = source.library.importmap,
-            archives = direct,
-            out_lib = partial_lib,
-            out_export = out_export,
-            gc_goopts = source.gc_goopts,
-            testfilter = testfilter,
-            asmhdr = asmhdr,
-        )
-
+    # Assembly files must be passed to the compiler as sources. The compile
+    # builder runs the assembler to produce a symabis file for the compiler.
+    # With the compile_asm feature, it also assembles each file and packs the
+    # objects into the archive, so this doesn't take separate actions.
+    # Otherwise, individual .o files are produced with separate actions.
+    # Objects from cgo archives are packed into a copy of the compiled
+    # archive by a separate action.
+    assemble = bool(split.asm) and "compile_asm" in go._ctx.features
+    extra_objects = []
+    compile_lib = out_lib
+    if (split.asm and not assemble) or source.cgo_archives:
+        compile_lib = go.declare_file(go, path = lib_name + "~partial", ext = ".a")
+    go.compile(
+        go,
+        sources = split.go + split.asm + split.headers,
+        importpath = source.library.importmap,
+        archives = direct,
+        deps_index = deps_index,
+        out_deps_index = out_deps_index,
+        out_lib = compile_lib,
+        out_header = out_header,
+        out_export = out_export,
+        out_vetx = out_vetx,
+        out_findings = out_findings,
+        out_fixes = out_fixes,
+        out_baseline = out_baseline,
+        out_profile = out_profile,
+        out_cpu_profile = out_cpu_profile,
+        out_unused_deps = out_unused_deps,
+        out_stats = out_stats,
+        unused_deps = unused_deps,
+        gc_goopts = source.gc_goopts,
+        testfilter = testfilter,
+        asmhdr = asmhdr,
+        assemble = assemble,
+        embedsrcs = source.embedsrcs,
+    )
+    if split.asm and not assemble:
         # include other .s as inputs, since they may be #included.
         # This may result in multiple copies of symbols defined in included
         # files, but go build allows it, so we do, too.
         asm_headers = split.headers + split.asm + [asmhdr]
-        extra_objects = []
         for src in split.asm:
             extra_objects.append(go.asm(go, source = src, hdrs = asm_headers))
+    if compile_lib != out_lib:
         go.pack(
             go,
-            in_lib = partial_lib,
+            in_lib = compile_lib,
             out_lib = out_lib,
             objects = extra_objects,
             archives = source.cgo_archives,
@@ -117,7 +173,15 @@ def emit_archive(go, source = None):
         importmap = source.library.importmap,
         pathtype = source.library.pathtype,
         file = out_lib,
+        header_file = out_header if out_header else out_lib,
         export_file = out_export,
+        vetx_file = out_vetx,
+        findings_file = out_findings,
+        fixes_file = out_fixes,
+        baseline_file = out_baseline,
+        profile_files = tuple([f for f in (out_profile, out_cpu_profile) if f]),
+        unused_deps_file = out_unused_deps,
+        stats_file = out_stats,
         srcs = as_tuple(source.srcs),
         orig_srcs = as_tuple(source.orig_srcs),
         data_files = as_tuple(data_files),
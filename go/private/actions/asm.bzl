@@ -12,6 +12,10 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
+load(
+    "@io_bazel_rules_go//go/private:common.bzl",
+    "WORKER_EXECUTION_REQUIREMENTS",
+)
 load(
     "@io_bazel_rules_go//go/private:skylib/lib/sets.bzl",
     "sets",
@@ -33,7 +37,7 @@ def emit_asm(
     out_obj = go.declare_file(go, path = source.basename[:-2], ext = ".o")
     inputs = hdrs + go.sdk.tools + go.sdk.headers + go.stdlib.libs + [source]
 
-    args = go.builder_args(go)
+    args = go.builder_args(go, worker = True)
     args.add(source)
     args.add("--")
     includes = ([go.sdk.root_file.dirname + "/pkg/include"] +
@@ -52,5 +56,6 @@ def emit_asm(
         executable = go.builders.asm,
         arguments = [args],
         env = go.env,
+        execution_requirements = WORKER_EXECUTION_REQUIREMENTS if go.workers else {},
     )
     return out_obj
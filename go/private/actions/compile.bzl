@@ -12,6 +12,11 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
+load(
+    "@io_bazel_rules_go//go/private:common.bzl",
+    "WORKER_EXECUTION_REQUIREMENTS",
+    "pkg_dir",
+)
 load(
     "@io_bazel_rules_go//go/private:mode.bzl",
     "link_mode_args",
@@ -22,18 +27,47 @@ load(
 )
 
 def _archive(v):
-    return "{}={}={}".format(v.data.importpath, v.data.importmap, v.data.file.path)
+    return "{}={}={}".format(v.data.importpath, v.data.importmap, v.data.header_file.path)
+
+def _facts(v):
+    return "{}={}".format(v.data.importmap, v.data.export_file.path)
+
+def _vet_facts(v):
+    return "{}={}".format(v.data.importmap, v.data.vetx_file.path)
+
+def _deps_index_entry(d):
+    return "{}={}".format(d.importpath, d.label)
+
+def _embedsrc(f):
+    # //go:embed patterns are resolved relative to the package directory, which
+    # is the same for source and generated files once their roots are removed.
+    rel = f.path[len(f.root.path) + 1:] if f.root.path else f.path
+    return "{}={}".format(rel, f.path)
 
 def emit_compile(
         go,
         sources = None,
         importpath = "",  # actually importmap, left as importpath for compatibility
         archives = [],
+        deps_index = None,
+        out_deps_index = None,
         out_lib = None,
+        out_header = None,
         out_export = None,
+        out_vetx = None,
+        out_findings = None,
+        out_fixes = None,
+        out_baseline = None,
+        out_profile = None,
+        out_cpu_profile = None,
+        out_unused_deps = None,
+        out_stats = None,
+        unused_deps = "off",
         gc_goopts = [],
         testfilter = None,
-        asmhdr = None):
+        asmhdr = None,
+        assemble = False,
+        embedsrcs = []):
     """See go/toolchains.rst#compile for full documentation."""
 
     if sources == None:
@@ -47,28 +81,101 @@ def emit_compile(
         return _bootstrap_compile(go, sources, out_lib, gc_goopts)
 
     inputs = (sources + [go.package_list] +
-              [archive.data.file for archive in archives] +
+              [archive.data.header_file for archive in archives] +
               go.sdk.tools + go.sdk.headers + go.stdlib.libs)
     outputs = [out_lib]
 
-    builder_args = go.builder_args(go)
+    builder_args = go.builder_args(go, worker = True)
     builder_args.add_all(sources, before_each = "-src")
     builder_args.add_all(archives, before_each = "-arc", map_each = _archive)
     builder_args.add("-o", out_lib)
+    if out_header:
+        builder_args.add("-header", out_header)
+        outputs.append(out_header)
     builder_args.add("-package_list", go.package_list)
     if testfilter:
         builder_args.add("-testfilter", testfilter)
+    if unused_deps != "off":
+        builder_args.add("-unused_deps", unused_deps)
+    if out_unused_deps:
+        builder_args.add("-unused_deps_out", out_unused_deps)
+        outputs.append(out_unused_deps)
+    if out_stats:
+        builder_args.add("-stats", out_stats)
+        outputs.append(out_stats)
+    executable = go.builders.compile
     if go.nogo:
-        builder_args.add("-nogo", go.nogo)
+        if go.nogo_compile:
+            # The analyzers are linked into this builder.
+            executable = go.nogo_compile
+            builder_args.add("-nogo_in_process")
+        else:
+            builder_args.add("-nogo", go.nogo)
+            inputs.append(go.nogo)
         builder_args.add("-x", out_export)
-        inputs.append(go.nogo)
-        inputs.extend([archive.data.export_file for archive in archives])
+
+        # Facts files are passed explicitly, since dependencies are compiled
+        # against header archives, which aren't named like the facts files.
+        # Archives built without nogo don't have facts.
+        fact_archives = [archive for archive in archives if archive.data.export_file]
+        builder_args.add_all(fact_archives, before_each = "-facts", map_each = _facts)
+        inputs.extend([archive.data.export_file for archive in fact_archives])
+        vet_fact_archives = [archive for archive in archives if archive.data.vetx_file]
+        builder_args.add_all(vet_fact_archives, before_each = "-vet_facts", map_each = _vet_facts)
+        inputs.extend([archive.data.vetx_file for archive in vet_fact_archives])
+        if go.nogo_stdlib_facts:
+            builder_args.add("-stdlib_facts", go.nogo_stdlib_facts.path)
+            inputs.append(go.nogo_stdlib_facts)
         outputs.append(out_export)
+        if out_vetx:
+            builder_args.add("-vetx", out_vetx)
+            outputs.append(out_vetx)
+        if out_findings:
+            builder_args.add("-findings", out_findings)
+            outputs.append(out_findings)
+        if out_fixes:
+            builder_args.add("-fixes", out_fixes)
+            outputs.append(out_fixes)
+        if out_baseline:
+            builder_args.add("-baseline", out_baseline)
+            outputs.append(out_baseline)
+        if out_profile:
+            builder_args.add("-profile", out_profile)
+            outputs.append(out_profile)
+        if out_cpu_profile:
+            if go.nogo_compile:
+                fail("the nogo_cpu_profile feature can't be used with a nogo target that has in_process = True")
+            builder_args.add("-cpuprofile", out_cpu_profile)
+            outputs.append(out_cpu_profile)
+
+    if embedsrcs:
+        builder_args.add("-embeddir", pkg_dir(go._ctx.label.workspace_root, go._ctx.label.package))
+        builder_args.add_all(embedsrcs, before_each = "-embedsrc", map_each = _embedsrc)
+        inputs.extend(embedsrcs)
+
+    # The index lists every transitive dependency, and it's only read when the
+    # strict dependency check fails, so it's written to its own file by a
+    # separate action instead of being passed on the command line. The depset
+    # is expanded when that action runs, not during analysis. The compile
+    # action only gets the path, so persistent workers can still be reused.
+    if deps_index != None and out_deps_index:
+        builder_args.add("-label", str(go._ctx.label))
+        builder_args.add("-deps_index", out_deps_index)
+        inputs.append(out_deps_index)
+        _emit_deps_index(go, deps_index, out_deps_index)
+    arguments = [builder_args]
 
-    tool_args = go.tool_args(go)
+    # Tool arguments are passed in a separate params file, so "--" is included
+    # there rather than as a separate argument, which wouldn't be passed to a
+    # persistent worker.
+    tool_args = go.tool_args(go, worker = True)
+    tool_args.add("--")
     if asmhdr:
         builder_args.add("-asmhdr", asmhdr)
         outputs.append(asmhdr)
+    if assemble:
+        builder_args.add("-assemble")
+        builder_args.add_all(link_mode_args(go.mode), before_each = "-asmflag")
     tool_args.add("-trimpath", ".")
 
     #TODO: Check if we really need this expand make variables in here
@@ -89,9 +196,26 @@ def emit_compile(
         inputs = inputs,
         outputs = outputs,
         mnemonic = "GoCompile",
-        executable = go.builders.compile,
-        arguments = [builder_args, "--", tool_args],
+        executable = executable,
+        arguments = arguments + [tool_args],
         env = go.env,
+        execution_requirements = WORKER_EXECUTION_REQUIREMENTS if go.workers else {},
+    )
+
+def _emit_deps_index(go, deps_index, out_deps_index):
+    # Bazel writes the entries to a params file when the action runs, then
+    # the file is copied to its declared output.
+    index_args = go.actions.args()
+    index_args.use_param_file("%s", use_always = True)
+    index_args.set_param_file_format("multiline")
+    index_args.add_all(deps_index, map_each = _deps_index_entry)
+    out_args = go.actions.args()
+    out_args.add(out_deps_index)
+    go.actions.run_shell(
+        outputs = [out_deps_index],
+        arguments = [index_args, out_args],
+        mnemonic = "GoDepsIndex",
+        command = "cp \"$1\" \"$2\"",
     )
 
 def _bootstrap_compile(go, sources, out_lib, gc_goopts):
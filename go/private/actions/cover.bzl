@@ -12,6 +12,10 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
+load(
+    "@io_bazel_rules_go//go/private:common.bzl",
+    "WORKER_EXECUTION_REQUIREMENTS",
+)
 load(
     "@io_bazel_rules_go//go/private:providers.bzl",
     "GoSource",
@@ -50,7 +54,7 @@ def emit_cover(go, source):
         covered_src_map[out] = orig
         covered.append(out)
 
-        args = go.builder_args(go)
+        args = go.builder_args(go, worker = True)
         args.add("-o", out)
         args.add("-var", cover_var)
         args.add("-src", src)
@@ -64,6 +68,7 @@ def emit_cover(go, source):
             executable = go.builders.cover,
             arguments = [args],
             env = go.env,
+            execution_requirements = WORKER_EXECUTION_REQUIREMENTS if go.workers else {},
         )
     members = structs.to_dict(source)
     members["srcs"] = covered
@@ -12,6 +12,11 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
+load(
+    "@io_bazel_rules_go//go/private:common.bzl",
+    "WORKER_EXECUTION_REQUIREMENTS",
+)
+
 def emit_pack(
         go,
         in_lib = None,
@@ -27,7 +32,7 @@ def emit_pack(
 
     inputs = [in_lib] + go.sdk.tools + objects + archives
 
-    args = go.builder_args(go)
+    args = go.builder_args(go, worker = True)
     args.add("-in", in_lib)
     args.add("-out", out_lib)
     args.add_all(objects, before_each = "-obj")
@@ -40,4 +45,5 @@ def emit_pack(
         executable = go.builders.pack,
         arguments = [args],
         env = go.env,
+        execution_requirements = WORKER_EXECUTION_REQUIREMENTS if go.workers else {},
     )
@@ -155,6 +155,12 @@ def goos_to_shared_extension(goos):
 
 MINIMUM_BAZEL_VERSION = "0.8.0"
 
+# Execution requirements for actions run by builders that support Bazel's
+# persistent worker protocol, when the persistent_workers feature is enabled
+# (go.workers is True). Arguments for these actions must be created with
+# go.builder_args(go, worker = True), so they're passed in params files.
+WORKER_EXECUTION_REQUIREMENTS = {"supports-workers": "1"}
+
 def as_list(v):
     if type(v) == "list":
         return v
@@ -30,6 +30,7 @@ load(
     "EXPORT_PATH",
     "GoBuilders",
     "GoLibrary",
+    "GoNogo",
     "GoSource",
     "GoStdLib",
     "INFERRED_PATH",
@@ -108,21 +109,28 @@ def _new_args(go):
     # TODO(jayconrod): print warning.
     return go.builder_args(go)
 
-def _builder_args(go):
+def _builder_args(go, worker = False):
     args = go.actions.args()
-    args.use_param_file("-param=%s")
-    args.set_param_file_format("multiline")
+    _use_param_file(args, worker and go.workers)
     args.add("-sdk", go.sdk.root_file.dirname)
     args.add("-installsuffix", installsuffix(go.mode))
     args.add_joined("-tags", go.tags, join_with = ",")
     return args
 
-def _tool_args(go):
+def _tool_args(go, worker = False):
     args = go.actions.args()
-    args.use_param_file("-param=%s")
-    args.set_param_file_format("multiline")
+    _use_param_file(args, worker and go.workers)
     return args
 
+def _use_param_file(args, worker):
+    if worker:
+        # Bazel only passes arguments in params files named with "@" to
+        # persistent workers. Other arguments are used to start the worker.
+        args.use_param_file("@%s", use_always = True)
+    else:
+        args.use_param_file("-param=%s")
+    args.set_param_file_format("multiline")
+
 def _new_library(go, name = None, importpath = None, resolver = None, importable = True, testfilter = None, **kwargs):
     if not importpath:
         importpath = go.importpath
@@ -149,6 +157,7 @@ def _merge_embed(source, embed):
     source["srcs"] = s.srcs + source["srcs"]
     source["orig_srcs"] = s.orig_srcs + source["orig_srcs"]
     source["orig_src_map"].update(s.orig_src_map)
+    source["embedsrcs"] = s.embedsrcs + source["embedsrcs"]
     source["cover"] = source["cover"] + s.cover
     source["deps"] = source["deps"] + s.deps
     source["x_defs"].update(s.x_defs)
@@ -194,6 +203,7 @@ def _library_to_source(go, attr, library, coverage_instrumented):
         "srcs": srcs,
         "orig_srcs": srcs,
         "orig_src_map": {},
+        "embedsrcs": [f for t in getattr(attr, "embedsrcs", []) for f in as_iterable(t.files)],
         "cover": [],
         "x_defs": {},
         "deps": getattr(attr, "deps", []),
@@ -297,10 +307,15 @@ def go_context(ctx, attr = None):
         builders = builders[GoBuilders]
 
     nogo = None
+    nogo_stdlib_facts = None
+    nogo_compile = None
     if hasattr(attr, "_nogo"):
         nogo_files = attr._nogo.files.to_list()
         if nogo_files:
             nogo = nogo_files[0]
+            if GoNogo in attr._nogo:
+                nogo_stdlib_facts = attr._nogo[GoNogo].stdlib_facts
+                nogo_compile = attr._nogo[GoNogo].compile
 
     coverdata = getattr(attr, "_coverdata", None)
     if coverdata:
@@ -364,9 +379,12 @@ def go_context(ctx, attr = None):
         cgo_tools = context_data.cgo_tools,
         builders = builders,
         nogo = nogo,
+        nogo_stdlib_facts = nogo_stdlib_facts,
+        nogo_compile = nogo_compile,
         coverdata = coverdata,
         coverage_enabled = ctx.configuration.coverage_enabled,
         coverage_instrumented = ctx.coverage_instrumented(),
+        workers = "persistent_workers" in ctx.features,
         env = env,
         tags = tags,
         # Action generators
@@ -73,6 +73,8 @@ GoStdLib = provider()
 
 GoBuilders = provider()
 
+GoNogo = provider()
+
 EXPLICIT_PATH = "explicit"
 
 INFERRED_PATH = "inferred"
@@ -48,6 +48,7 @@ _SHARED_ATTRS = {
     "basename": attr.string(),
     "data": attr.label_list(allow_files = True),
     "srcs": attr.label_list(allow_files = go_exts + asm_exts),
+    "embedsrcs": attr.label_list(allow_files = True),
     "gc_goopts": attr.string_list(),
     "gc_linkopts": attr.string_list(),
     "x_defs": attr.string_dict(),
@@ -86,6 +87,12 @@ def _go_binary_impl(ctx):
         OutputGroupInfo(
             cgo_exports = archive.cgo_exports,
             compilation_outputs = [archive.data.file],
+            nogo_findings = [archive.data.findings_file] if archive.data.findings_file else [],
+            nogo_fixes = [archive.data.fixes_file] if archive.data.fixes_file else [],
+            nogo_baseline = [archive.data.baseline_file] if archive.data.baseline_file else [],
+            nogo_profile = list(archive.data.profile_files),
+            unused_deps = [archive.data.unused_deps_file] if archive.data.unused_deps_file else [],
+            compile_stats = [archive.data.stats_file] if archive.data.stats_file else [],
         ),
         DefaultInfo(
             files = depset([executable]),
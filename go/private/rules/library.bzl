@@ -45,6 +45,12 @@ def _go_library_impl(ctx):
         OutputGroupInfo(
             cgo_exports = archive.cgo_exports,
             compilation_outputs = [archive.data.file],
+            nogo_findings = [archive.data.findings_file] if archive.data.findings_file else [],
+            nogo_fixes = [archive.data.fixes_file] if archive.data.fixes_file else [],
+            nogo_baseline = [archive.data.baseline_file] if archive.data.baseline_file else [],
+            nogo_profile = list(archive.data.profile_files),
+            unused_deps = [archive.data.unused_deps_file] if archive.data.unused_deps_file else [],
+            compile_stats = [archive.data.stats_file] if archive.data.stats_file else [],
         ),
     ]
 
@@ -53,6 +59,7 @@ go_library = go_rule(
     attrs = {
         "data": attr.label_list(allow_files = True),
         "srcs": attr.label_list(allow_files = True),
+        "embedsrcs": attr.label_list(allow_files = True),
         "deps": attr.label_list(providers = [GoLibrary]),
         "importpath": attr.string(),
         "importmap": attr.string(),
@@ -72,6 +79,7 @@ go_tool_library = go_rule(
     attrs = {
         "data": attr.label_list(allow_files = True),
         "srcs": attr.label_list(allow_files = True),
+        "embedsrcs": attr.label_list(allow_files = True),
         "deps": attr.label_list(providers = [GoLibrary]),
         "importpath": attr.string(),
         "importmap": attr.string(),
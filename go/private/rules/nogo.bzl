@@ -28,6 +28,7 @@ load(
     "@io_bazel_rules_go//go/private:providers.bzl",
     "GoArchive",
     "GoLibrary",
+    "GoNogo",
     "get_archive",
 )
 
@@ -49,6 +50,14 @@ def _nogo_impl(ctx):
     if ctx.file.config:
         nogo_args.add("-config", ctx.file.config)
         nogo_inputs.append(ctx.file.config)
+    if ctx.file.baseline:
+        nogo_args.add("-baseline", ctx.file.baseline)
+        nogo_inputs.append(ctx.file.baseline)
+    nogo_args.add("-findings_format", ctx.attr.findings_format)
+    if ctx.attr.report_unused_ignores:
+        nogo_args.add("-report_unused_ignores")
+    if ctx.attr.vet:
+        nogo_args.add("-vet")
     ctx.actions.run(
         inputs = nogo_inputs,
         outputs = [nogo_main],
@@ -77,11 +86,77 @@ def _nogo_impl(ctx):
         name = ctx.label.name,
         source = nogo_source,
     )
-    return [DefaultInfo(
-        files = depset([executable]),
-        runfiles = nogo_archive.runfiles,
-        executable = executable,
-    )]
+
+    # Compile a builder that compiles packages and runs the analyzers in the
+    # same process, if requested. The nogo binary is still needed to compute
+    # facts for the standard library.
+    compile = None
+    if ctx.attr.in_process:
+        compile_library = GoLibrary(
+            name = go._ctx.label.name + "~nogo_compile",
+            label = go._ctx.label,
+            importpath = "nogocompile",
+            importmap = "nogocompile",
+            pathtype = EXPORT_PATH,
+            resolve = None,
+        )
+        compile_source = go.library_to_source(go, struct(
+            srcs = [struct(files = [nogo_main])],
+            embed = [ctx.attr._nogo_compile_srcs],
+            deps = analyzer_archives,
+        ), compile_library, False)
+        _, compile, _ = go.binary(
+            go,
+            name = ctx.label.name + "_compile",
+            source = compile_source,
+        )
+
+    stdlib_facts = None
+    output_groups = {}
+    if ctx.attr.stdlib_facts:
+        stdlib_facts = _stdlib_facts(go, ctx.attr._stdlib_builder, executable)
+        output_groups["stdlib_facts"] = depset([stdlib_facts])
+
+    return [
+        DefaultInfo(
+            files = depset([executable]),
+            runfiles = nogo_archive.runfiles,
+            executable = executable,
+        ),
+        GoNogo(
+            stdlib_facts = stdlib_facts,
+            compile = compile,
+        ),
+        OutputGroupInfo(**output_groups),
+    ]
+
+def _stdlib_facts(go, builder, nogo):
+    """Runs nogo on the standard library and returns a directory of facts.
+
+    Sources are read from the SDK, and export data is read from the standard
+    library nogo was built with. nogo is built for the host, so these facts
+    are computed for the host platform, even when cross-compiling.
+    """
+    out = go.declare_directory(go, "stdlib_facts")
+    args = go.builder_args(go)
+    args.add("-nogo", nogo)
+    args.add("-archive_root", go.stdlib.root_file.dirname)
+    args.add("-facts_out", out.path)
+    env = dict(go.env)
+    env["GOROOT"] = go.sdk.root_file.dirname
+    inputs = (go.sdk.srcs +
+              go.sdk.tools +
+              go.stdlib.libs +
+              [go.sdk.go, go.sdk.root_file, go.stdlib.root_file, nogo])
+    go.actions.run(
+        inputs = inputs,
+        outputs = [out],
+        mnemonic = "GoStdlibFacts",
+        executable = builder.files.to_list()[0],
+        arguments = [args],
+        env = env,
+    )
+    return out
 
 nogo = go_rule(
     _nogo_impl,
@@ -96,20 +171,27 @@ nogo = go_rule(
         "config": attr.label(
             allow_single_file = True,
         ),
+        "baseline": attr.label(
+            allow_single_file = True,
+        ),
+        "findings_format": attr.string(
+            default = "json",
+            values = ["json", "sarif"],
+        ),
+        "report_unused_ignores": attr.bool(default = False),
+        "vet": attr.bool(default = False),
+        "stdlib_facts": attr.bool(default = False),
+        "in_process": attr.bool(default = False),
         "_nogo_srcs": attr.label(
             default = "@io_bazel_rules_go//go/tools/builders:nogo_srcs",
         ),
+        "_nogo_compile_srcs": attr.label(
+            default = "@io_bazel_rules_go//go/tools/builders:nogo_compile_srcs",
+        ),
+        "_stdlib_builder": attr.label(
+            executable = True,
+            cfg = "host",
+            default = "@io_bazel_rules_go//go/tools/builders:stdlib",
+        ),
     },
 )
-
-def nogo_wrapper(**kwargs):
-    if kwargs.get("vet"):
-        kwargs["deps"] = kwargs.get("deps", []) + [
-            "@org_golang_x_tools//go/analysis/passes/atomic:go_tool_library",
-            "@org_golang_x_tools//go/analysis/passes/bools:go_tool_library",
-            "@org_golang_x_tools//go/analysis/passes/buildtag:go_tool_library",
-            "@org_golang_x_tools//go/analysis/passes/nilfunc:go_tool_library",
-            "@org_golang_x_tools//go/analysis/passes/printf:go_tool_library",
-        ]
-        kwargs = {k: v for k, v in kwargs.items() if k != "vet"}
-    nogo(**kwargs)
@@ -77,6 +77,7 @@ def _go_test_impl(ctx):
     )
     external_source = go.library_to_source(go, struct(
         srcs = [struct(files = go_srcs)],
+        embedsrcs = [struct(files = internal_source.embedsrcs)],
         deps = internal_archive.direct + [internal_archive],
         x_defs = ctx.attr.x_defs,
     ), external_library, ctx.coverage_instrumented())
@@ -98,6 +99,8 @@ def _go_test_impl(ctx):
     arguments.add("-output", main_go)
     if ctx.configuration.coverage_enabled:
         arguments.add("-coverage")
+    if ctx.file.shard_timings:
+        arguments.add("-shard_timings", ctx.file.shard_timings.short_path)
     arguments.add(
         # the l is the alias for the package under test, the l_test must be the
         # same with the test suffix
@@ -132,6 +135,14 @@ def _go_test_impl(ctx):
     test_deps = external_archive.direct + [external_archive]
     if ctx.configuration.coverage_enabled:
         test_deps.append(go.coverdata)
+
+    # The generated main imports packages that implement Bazel's test
+    # protocol. When one of those packages is the one under test, it's
+    # already a dependency through the internal test archive.
+    for dep in ctx.attr._testmain_additional_deps:
+        archive = get_archive(dep)
+        if archive.data.importpath != internal_archive.data.importpath:
+            test_deps.append(archive)
     test_source = go.library_to_source(go, struct(
         srcs = [struct(files = [main_go])],
         deps = test_deps,
@@ -145,6 +156,8 @@ def _go_test_impl(ctx):
         version_file = ctx.version_file,
         info_file = ctx.info_file,
     )
+    if ctx.file.shard_timings:
+        runfiles = runfiles.merge(ctx.runfiles(files = [ctx.file.shard_timings]))
 
     # Bazel only looks for coverage data if the test target has an
     # InstrumentedFilesProvider, but this provider can currently only be
@@ -164,6 +177,31 @@ def _go_test_impl(ctx):
             ),
             OutputGroupInfo(
                 compilation_outputs = [internal_archive.data.file],
+                nogo_findings = [
+                    a.data.findings_file
+                    for a in (internal_archive, external_archive)
+                    if a.data.findings_file
+                ],
+                nogo_fixes = [
+                    a.data.fixes_file
+                    for a in (internal_archive, external_archive)
+                    if a.data.fixes_file
+                ],
+                nogo_baseline = [
+                    a.data.baseline_file
+                    for a in (internal_archive, external_archive)
+                    if a.data.baseline_file
+                ],
+                nogo_profile = [
+                    f
+                    for a in (internal_archive, external_archive)
+                    for f in a.data.profile_files
+                ],
+                compile_stats = [
+                    a.data.stats_file
+                    for a in (internal_archive, external_archive)
+                    if a.data.stats_file
+                ],
             ),
         ],
         instrumented_files = struct(
@@ -178,6 +216,7 @@ go_test = go_rule(
     attrs = {
         "data": attr.label_list(allow_files = True),
         "srcs": attr.label_list(allow_files = go_exts + asm_exts),
+        "embedsrcs": attr.label_list(allow_files = True),
         "deps": attr.label_list(
             providers = [GoLibrary],
             aspects = [go_archive_aspect],
@@ -230,6 +269,12 @@ go_test = go_rule(
         "gc_goopts": attr.string_list(),
         "gc_linkopts": attr.string_list(),
         "rundir": attr.string(),
+        "shard_timings": attr.label(allow_single_file = True),
+        "_testmain_additional_deps": attr.label_list(
+            providers = [GoLibrary],
+            default = ["@io_bazel_rules_go//go/tools/bzltestutil"],
+            aspects = [go_archive_aspect],
+        ),
         "x_defs": attr.string_dict(),
         "linkmode": attr.string(default = LINKMODE_NORMAL),
         # Workaround for bazelbuild/bazel#6293. See comment in lcov_merger.sh.
@@ -31,7 +31,7 @@ func run(args []string) error {
 		return err
 	}
 	builderArgs, toolArgs := splitArgs(args)
-	flags := flag.NewFlagSet("GoAsm", flag.ExitOnError)
+	flags := flag.NewFlagSet("GoAsm", flag.ContinueOnError)
 	goenv := envFlags(flags)
 	if err := flags.Parse(builderArgs); err != nil {
 		return err
@@ -54,7 +54,8 @@ func run(args []string) error {
 	}
 
 	// Build source with the assembler.
-	goargs := goenv.goTool("asm", toolArgs...)
+	goargs := goenv.goTool("asm", asmDefines()...)
+	goargs = append(goargs, toolArgs...)
 	goargs = append(goargs, source)
 	absArgs(goargs, []string{"-I", "-o", "-trimpath"})
 	return goenv.runCommand(goargs)
@@ -63,7 +64,7 @@ func run(args []string) error {
 func main() {
 	log.SetFlags(0)
 	log.SetPrefix("GoAsm: ")
-	if err := run(os.Args[1:]); err != nil {
+	if err := runBuilder(os.Args[1:], run); err != nil {
 		log.Fatal(err)
 	}
 }
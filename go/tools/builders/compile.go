@@ -12,12 +12,14 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// compile compiles .go files with "go tool compile". It is invoked by the
-// Go rules as an action.
+// compile compiles .go files with "go tool compile". With -assemble, it then
+// assembles .s files in the same package with "go tool asm" and packs the
+// objects into the archive. It is invoked by the Go rules as an action.
 package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -29,11 +31,15 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
-	"runtime"
-	"strconv"
+	"sort"
 	"strings"
+	"time"
 )
 
+// inProcessNogo runs nogo's analyzers in this process. It's only set when
+// the compile builder is linked with nogo (see compile_nogo.go).
+var inProcessNogo func(args []string, stderr io.Writer) error
+
 type archive struct {
 	importPath, importMap, file string
 }
@@ -45,7 +51,7 @@ func run(args []string) error {
 		return err
 	}
 	builderArgs, toolArgs := splitArgs(args)
-	flags := flag.NewFlagSet("GoCompile", flag.ExitOnError)
+	flags := flag.NewFlagSet("GoCompile", flag.ContinueOnError)
 	unfiltered := multiFlag{}
 	archives := archiveMultiFlag{}
 	goenv := envFlags(flags)
@@ -53,17 +59,54 @@ func run(args []string) error {
 	flags.Var(&unfiltered, "src", "A source file to be filtered and compiled")
 	flags.Var(&archives, "arc", "Import path, package path, and file name of a direct dependency, separated by '='")
 	nogo := flags.String("nogo", "", "The nogo binary")
+	nogoInProcess := flags.Bool("nogo_in_process", false, "Run nogo's analyzers in this process instead of running a nogo binary. The builder must be linked with nogo.")
 	outExport := flags.String("x", "", "Path to nogo that should be written")
+	outVetx := flags.String("vetx", "", "Path to vet facts that should be written by nogo")
+	outFindings := flags.String("findings", "", "Path to nogo findings that should be written")
+	outFixes := flags.String("fixes", "", "Path to a patch with nogo suggested fixes that should be written. nogo diagnostics with suggested fixes do not fail the build when this is set.")
+	outBaseline := flags.String("baseline", "", "Path to a nogo baseline file that should be written. nogo diagnostics do not fail the build when this is set, but other nogo errors do.")
+	outProfile := flags.String("profile", "", "Path to a file where nogo should record the time used by each analyzer")
+	outCPUProfile := flags.String("cpuprofile", "", "Path to a pprof CPU profile of nogo that should be written")
+	stdlibFacts := flags.String("stdlib_facts", "", "Path to a directory containing nogo facts for the standard library")
+	depFacts := multiFlag{}
+	flags.Var(&depFacts, "facts", "Package path of a direct dependency and the file with facts nogo computed for it, separated by '='")
+	depVetFacts := multiFlag{}
+	flags.Var(&depVetFacts, "vet_facts", "Package path of a direct dependency and the file with facts vet computed for it, separated by '='")
 	output := flags.String("o", "", "The output object file to write")
+	outHeader := flags.String("header", "", "Path to an archive containing only export data that should be written. If set, the output object file contains only what the linker needs.")
 	asmhdr := flags.String("asmhdr", "", "Path to assembly header file to write")
+	embedSrcs := embedSrcMultiFlag{}
+	flags.Var(&embedSrcs, "embedsrc", "A file that may be embedded with //go:embed, as its path relative to the root of the source or output tree, and its path, separated by '='")
+	embedDir := flags.String("embeddir", ".", "The package directory relative to the root of the source or output tree. //go:embed patterns are resolved in this directory.")
+	assemble := flags.Bool("assemble", false, "Assemble .s files and pack the objects into the output archive")
+	asmFlags := multiFlag{}
+	flags.Var(&asmFlags, "asmflag", "A flag to pass to the assembler with -assemble (may be repeated)")
 	packageList := flags.String("package_list", "", "The file containing the list of standard library packages")
 	testfilter := flags.String("testfilter", "off", "Controls test package filtering")
+	unusedDeps := flags.String("unused_deps", "off", "Controls how direct dependencies that aren't imported are reported: off, warn, or error")
+	outUnusedDeps := flags.String("unused_deps_out", "", "Path to a JSON file listing direct dependencies that aren't imported that should be written")
+	outStats := flags.String("stats", "", "Path to a JSON file where statistics about this action should be written")
+	label := flags.String("label", "", "The label of the target being compiled, used in suggested fixes")
+	depsIndex := flags.String("deps_index", "", "Path to a file mapping import paths of transitive dependencies to labels, used in suggested fixes")
 	if err := flags.Parse(builderArgs); err != nil {
 		return err
 	}
 	if err := goenv.checkFlags(); err != nil {
 		return err
 	}
+	switch *unusedDeps {
+	case "off", "warn", "error":
+	default:
+		return fmt.Errorf("Invalid unused_deps mode %q", *unusedDeps)
+	}
+	if *nogoInProcess && inProcessNogo == nil {
+		return errors.New("-nogo_in_process was set, but the builder was not linked with nogo")
+	}
+	if *nogoInProcess && *outCPUProfile != "" {
+		// The CPU profile is global to the process, which may be a persistent
+		// worker compiling other packages at the same time.
+		return errors.New("-cpuprofile can't be used with -nogo_in_process")
+	}
 	*output = abs(*output)
 	if *asmhdr != "" {
 		*asmhdr = abs(*asmhdr)
@@ -107,6 +150,7 @@ func run(args []string) error {
 			}
 		}
 	}
+	numGoFiles := len(goFiles)
 	if len(goFiles) == 0 {
 		// We need to run the compiler to create a valid archive, even if there's
 		// nothing in it. GoPack will complain if we try to add assembly or cgo
@@ -124,18 +168,55 @@ func run(args []string) error {
 
 	// Check that the filtered sources don't import anything outside of
 	// the standard library and the direct dependencies.
-	_, stdImports, err := checkDirectDeps(goFiles, archives, *packageList)
+	depImports, stdImports, relImports, err := checkDirectDeps(goFiles, archives, *packageList, *packagePath)
+	if derr, ok := err.(depsError); ok && *depsIndex != "" {
+		index, ierr := readDepsIndex(*depsIndex)
+		if ierr != nil {
+			return ierr
+		}
+		derr.label = *label
+		derr.index = index
+		err = derr
+	}
 	if err != nil {
 		return err
 	}
 
+	// Check for direct dependencies that aren't imported by the filtered
+	// sources.
+	if *unusedDeps != "off" || *outUnusedDeps != "" {
+		unused := unusedDepsError{unused: findUnusedDeps(archives, depImports)}
+		if *outUnusedDeps != "" {
+			if err := writeUnusedDeps(*outUnusedDeps, *packagePath, unused.unused); err != nil {
+				return err
+			}
+		}
+		if len(unused.unused) > 0 {
+			switch *unusedDeps {
+			case "warn":
+				fmt.Fprintln(os.Stderr, unused.Error())
+			case "error":
+				return unused
+			}
+		}
+	}
+
 	// Build an importcfg file for the compiler.
-	importcfgName, err := buildImportcfgFile(archives, stdImports, goenv.installSuffix, filepath.Dir(*output))
+	importcfgName, err := buildImportcfgFile(archives, stdImports, relImports, goenv.installSuffix, filepath.Dir(*output))
 	if err != nil {
 		return err
 	}
 	defer os.Remove(importcfgName)
 
+	// Resolve //go:embed patterns against the files that may be embedded.
+	embedcfgName, err := buildEmbedcfgFile(goFiles, embedSrcs, *embedDir, filepath.Dir(*output))
+	if embedcfgName != "" {
+		defer os.Remove(embedcfgName)
+	}
+	if err != nil {
+		return err
+	}
+
 	// If there are assembly files, and this is go1.12+, generate symbol ABIs.
 	symabisName, err := buildSymabisFile(goenv, sFiles, hFiles, *asmhdr)
 	if symabisName != "" {
@@ -149,10 +230,20 @@ func run(args []string) error {
 	goargs := goenv.goTool("compile")
 	goargs = append(goargs, "-p", *packagePath)
 	goargs = append(goargs, "-importcfg", importcfgName)
-	goargs = append(goargs, "-pack", "-o", *output)
+	if *outHeader != "" {
+		// Dependent packages are compiled against the export data in the header
+		// archive, so they don't need to be recompiled when only the object
+		// code changes.
+		goargs = append(goargs, "-pack", "-o", *outHeader, "-linkobj", *output)
+	} else {
+		goargs = append(goargs, "-pack", "-o", *output)
+	}
 	if symabisName != "" {
 		goargs = append(goargs, "-symabis", symabisName)
 	}
+	if embedcfgName != "" {
+		goargs = append(goargs, "-embedcfg", embedcfgName)
+	}
 	if *asmhdr != "" {
 		goargs = append(goargs, "-asmhdr", *asmhdr)
 	}
@@ -163,18 +254,30 @@ func run(args []string) error {
 		filenames = append(filenames, f.filename)
 	}
 	goargs = append(goargs, filenames...)
-	absArgs(goargs, []string{"-I", "-o", "-trimpath", "-importcfg"})
+	absArgs(goargs, []string{"-I", "-o", "-linkobj", "-trimpath", "-importcfg", "-embedcfg"})
 	cmd := exec.Command(goargs[0], goargs[1:]...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	compileStart := time.Now()
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("error starting compiler: %v", err)
 	}
+	// Wait for the compiler in the background, so its wall time doesn't
+	// include the time nogo takes.
+	var compileTime time.Duration
+	compileDone := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		compileTime = time.Since(compileStart)
+		compileDone <- err
+	}()
 
 	// Run nogo concurrently.
 	var nogoOutput bytes.Buffer
 	nogoFailed := false
-	if *nogo != "" {
+	var nogoTime time.Duration
+	if *nogo != "" || *nogoInProcess {
+		nogoStart := time.Now()
 		var nogoargs []string
 		nogoargs = append(nogoargs, "-p", *packagePath)
 		nogoargs = append(nogoargs, "-importcfg", importcfgName)
@@ -182,22 +285,79 @@ func run(args []string) error {
 			nogoargs = append(nogoargs, "-stdimport", imp)
 		}
 		nogoargs = append(nogoargs, "-x", *outExport)
+		for _, f := range depFacts {
+			nogoargs = append(nogoargs, "-facts", f)
+		}
+		for _, f := range depVetFacts {
+			nogoargs = append(nogoargs, "-vet_facts", f)
+		}
+		if *stdlibFacts != "" {
+			nogoargs = append(nogoargs, "-stdlib_facts", *stdlibFacts)
+		}
+		if *outVetx != "" {
+			nogoargs = append(nogoargs, "-vet_tool", goenv.goTool("vet")[0], "-vetx", *outVetx)
+		}
+		if *outFindings != "" {
+			nogoargs = append(nogoargs, "-findings", *outFindings)
+		}
+		if *outFixes != "" {
+			nogoargs = append(nogoargs, "-fixes", *outFixes)
+		}
+		if *outBaseline != "" {
+			nogoargs = append(nogoargs, "-baseline", *outBaseline)
+		}
+		if *outProfile != "" {
+			nogoargs = append(nogoargs, "-profile", *outProfile)
+		}
+		if *outCPUProfile != "" {
+			nogoargs = append(nogoargs, "-cpuprofile", *outCPUProfile)
+		}
 		nogoargs = append(nogoargs, filenames...)
-		nogoCmd := exec.Command(*nogo, nogoargs...)
-		nogoCmd.Stdout, nogoCmd.Stderr = &nogoOutput, &nogoOutput
-		if err := nogoCmd.Run(); err != nil {
-			if _, ok := err.(*exec.ExitError); ok {
-				// Only fail the build if nogo runs and finds errors in source code.
+		if *nogoInProcess {
+			// Errors are reported the same way as when nogo exits with an
+			// error status.
+			if err := inProcessNogo(nogoargs, &nogoOutput); err != nil {
+				fmt.Fprintf(&nogoOutput, "nogo: %v\n", err)
 				nogoFailed = true
-			} else {
-				// All errors related to running nogo will merely be printed.
-				nogoOutput.WriteString(fmt.Sprintf("error running nogo: %v\n", err))
+			}
+		} else {
+			nogoCmd := exec.Command(*nogo, nogoargs...)
+			nogoCmd.Stdout, nogoCmd.Stderr = &nogoOutput, &nogoOutput
+			if err := nogoCmd.Run(); err != nil {
+				if _, ok := err.(*exec.ExitError); ok {
+					// Only fail the build if nogo runs and finds errors in source code
+					// or fails itself. In baseline mode, nogo records findings in a
+					// baseline file instead of failing. In fix mode, it only fails
+					// on errors it can't fix.
+					nogoFailed = true
+				} else {
+					// All errors related to running nogo will merely be printed.
+					nogoOutput.WriteString(fmt.Sprintf("error running nogo: %v\n", err))
+				}
 			}
 		}
+		nogoTime = time.Since(nogoStart)
 	}
-	if err := cmd.Wait(); err != nil {
+	if err := <-compileDone; err != nil {
 		return fmt.Errorf("error running compiler: %v", err)
 	}
+
+	// Assemble and pack assembly sources. This must happen after compiling,
+	// since the compiler writes go_asm.h. Otherwise, they're assembled by
+	// separate actions, and the objects are packed later.
+	if *assemble {
+		if err := assembleFiles(goenv, sFiles, hFiles, *asmhdr, asmFlags, *output); err != nil {
+			return err
+		}
+	}
+	if *outStats != "" {
+		stats := newCompileStats(*packagePath, numGoFiles, len(sFiles), depImports, stdImports)
+		stats.CompileWallNs = compileTime.Nanoseconds()
+		stats.NogoWallNs = nogoTime.Nanoseconds()
+		if err := writeCompileStats(*outStats, stats); err != nil {
+			return err
+		}
+	}
 	// Only print the output of nogo if compilation succeeds.
 	if nogoFailed {
 		return fmt.Errorf("%s", nogoOutput.String())
@@ -211,13 +371,13 @@ func run(args []string) error {
 func main() {
 	log.SetFlags(0) // no timestamp
 	log.SetPrefix("GoCompile: ")
-	if err := run(os.Args[1:]); err != nil {
+	if err := runBuilder(os.Args[1:], run); err != nil {
 		log.Fatal(err)
 	}
 }
 
-// TODO(#1891): consolidate this logic when compile and asm are in the
-// same binary.
+// buildSymabisFile runs the assembler on sFiles to generate a file describing
+// the ABIs of symbols they define, which the compiler needs to call them.
 func buildSymabisFile(goenv *env, sFiles, hFiles []*goMetadata, asmhdr string) (string, error) {
 	if len(sFiles) == 0 {
 		return "", nil
@@ -225,18 +385,8 @@ func buildSymabisFile(goenv *env, sFiles, hFiles []*goMetadata, asmhdr string) (
 
 	// Check version. The symabis file is only required and can only be built
 	// starting at go1.12.
-	version := runtime.Version()
-	if strings.HasPrefix(version, "go1.") {
-		minor := version[len("go1."):]
-		if i := strings.IndexByte(minor, '.'); i >= 0 {
-			minor = minor[:i]
-		}
-		n, err := strconv.Atoi(minor)
-		if err == nil && n <= 11 {
-			return "", nil
-		}
-		// Fall through if the version can't be parsed. It's probably a newer
-		// development version.
+	if minor, ok := goMinorVersion(); ok && minor <= 11 {
+		return "", nil
 	}
 
 	// Create an empty go_asm.h file. The compiler will write this later, but
@@ -260,38 +410,100 @@ func buildSymabisFile(goenv *env, sFiles, hFiles []*goMetadata, asmhdr string) (
 	symabisFile.Close()
 
 	// Run the assembler.
-	wd, err := os.Getwd()
+	asmargs, err := asmArgs(goenv, sFiles, hFiles, asmhdrDir)
 	if err != nil {
 		return symabisName, err
 	}
+	asmargs = append(asmargs, "-gensymabis", "-o", symabisName, "--")
+	for _, sFile := range sFiles {
+		asmargs = append(asmargs, sFile.filename)
+	}
+
+	err = goenv.runCommand(asmargs)
+	return symabisName, err
+}
+
+// asmArgs returns a command line for the assembler, up to the output file.
+// Headers may be included from the working directory, the SDK, the directory
+// containing go_asm.h, and the directories of other assembly sources and
+// headers. GOOS_, GOARCH_, and variant macros are defined as by "go build".
+func asmArgs(goenv *env, sFiles, hFiles []*goMetadata, asmhdrDir string) ([]string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
 	asmargs := goenv.goTool("asm")
 	asmargs = append(asmargs, "-trimpath", wd)
 	asmargs = append(asmargs, "-I", wd)
 	asmargs = append(asmargs, "-I", filepath.Join(os.Getenv("GOROOT"), "pkg", "include"))
 	asmargs = append(asmargs, "-I", asmhdrDir)
 	seenHdrDirs := map[string]bool{wd: true, asmhdrDir: true}
-	for _, hFile := range hFiles {
-		hdrDir := filepath.Dir(abs(hFile.filename))
-		if !seenHdrDirs[hdrDir] {
-			asmargs = append(asmargs, "-I", hdrDir)
-			seenHdrDirs[hdrDir] = true
+	for _, files := range [][]*goMetadata{hFiles, sFiles} {
+		for _, f := range files {
+			hdrDir := filepath.Dir(abs(f.filename))
+			if !seenHdrDirs[hdrDir] {
+				asmargs = append(asmargs, "-I", hdrDir)
+				seenHdrDirs[hdrDir] = true
+			}
 		}
 	}
-	// TODO(#1894): define GOOS_goos, GOARCH_goarch, both here and in the
-	// GoAsm action.
-	asmargs = append(asmargs, "-gensymabis", "-o", symabisName, "--")
+	asmargs = append(asmargs, asmDefines()...)
+	return asmargs, nil
+}
+
+// assembleFiles assembles each file in sFiles and appends the objects to
+// archive, which must already have been written by the compiler, along with
+// asmhdr. Each file is assembled separately, so symbols defined in files
+// included by other files may be defined more than once; go build allows
+// this, too. asmFlags are passed to each assembler command.
+func assembleFiles(goenv *env, sFiles, hFiles []*goMetadata, asmhdr string, asmFlags []string, archive string) error {
+	if len(sFiles) == 0 {
+		return nil
+	}
+	objDir, err := ioutil.TempDir("", "asm")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(objDir)
+
+	asmargs, err := asmArgs(goenv, sFiles, hFiles, filepath.Dir(asmhdr))
+	if err != nil {
+		return err
+	}
+	asmargs = append(asmargs, asmFlags...)
+	objNames := make(map[string]bool)
+	objs := make([]string, 0, len(sFiles))
 	for _, sFile := range sFiles {
-		asmargs = append(asmargs, sFile.filename)
+		// Objects are named after their sources, since these names may appear
+		// in linker errors.
+		base := strings.TrimSuffix(filepath.Base(sFile.filename), ".s")
+		objName := base + ".o"
+		for i := 1; objNames[objName]; i++ {
+			objName = fmt.Sprintf("%s_%d.o", base, i)
+		}
+		objNames[objName] = true
+		obj := filepath.Join(objDir, objName)
+		args := append(asmargs[:len(asmargs):len(asmargs)], "-o", obj, "--", sFile.filename)
+		if err := goenv.runCommand(args); err != nil {
+			return err
+		}
+		objs = append(objs, obj)
 	}
 
-	err = goenv.runCommand(asmargs)
-	return symabisName, err
+	packargs := goenv.goTool("pack", "r", archive)
+	packargs = append(packargs, objs...)
+	return goenv.runCommand(packargs)
 }
 
-func checkDirectDeps(files []*goMetadata, archives []archive, packageList string) (depImports, stdImports []string, err error) {
+// checkDirectDeps checks that the files only import packages in the standard
+// library or provided by archives. Relative imports are resolved against
+// packagePath and may name either the import path or the package path of an
+// archive. relImports maps each relative import to the package path
+// (importmap) of the archive it resolved to.
+func checkDirectDeps(files []*goMetadata, archives []archive, packageList, packagePath string) (depImports, stdImports []string, relImports map[string]string, err error) {
 	packagesTxt, err := ioutil.ReadFile(packageList)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, nil, err
 	}
 	stdlibSet := map[string]bool{}
 	for _, line := range strings.Split(string(packagesTxt), "\n") {
@@ -303,9 +515,13 @@ func checkDirectDeps(files []*goMetadata, archives []archive, packageList string
 
 	depSet := map[string]bool{}
 	depList := make([]string, len(archives))
+	importMapToPath := map[string]string{}
+	pathToImportMap := map[string]string{}
 	for i, arc := range archives {
 		depSet[arc.importPath] = true
 		depList[i] = arc.importPath
+		importMapToPath[arc.importMap] = arc.importPath
+		pathToImportMap[arc.importPath] = arc.importMap
 	}
 
 	importSet := map[string]bool{}
@@ -313,9 +529,29 @@ func checkDirectDeps(files []*goMetadata, archives []archive, packageList string
 	derr := depsError{known: depList}
 	for _, f := range files {
 		for _, path := range f.imports {
-			if path == "C" || isRelative(path) || importSet[path] {
-				// TODO(#1645): Support local (relative) import paths. We don't emit
-				// errors for them here, but they will probably break something else.
+			if path == "C" || importSet[path] {
+				continue
+			}
+			if isRelative(path) {
+				resolved, ok := resolveRelativeImport(packagePath, path)
+				if !ok {
+					derr.missing = append(derr.missing, missingDep{filename: f.filename, imp: path})
+					continue
+				}
+				// The relative path is usually the package path of a dependency,
+				// since it's resolved against the package path of this package.
+				if depPath, ok := importMapToPath[resolved]; ok {
+					resolved = depPath
+				}
+				if !depSet[resolved] {
+					derr.missing = append(derr.missing, missingDep{filename: f.filename, imp: path, resolved: resolved})
+					continue
+				}
+				if relImports == nil {
+					relImports = make(map[string]string)
+				}
+				depImports = append(depImports, resolved)
+				relImports[path] = pathToImportMap[resolved]
 				continue
 			}
 			if stdlibSet[path] {
@@ -326,16 +562,16 @@ func checkDirectDeps(files []*goMetadata, archives []archive, packageList string
 				depImports = append(depImports, path)
 				continue
 			}
-			derr.missing = append(derr.missing, missingDep{f.filename, path})
+			derr.missing = append(derr.missing, missingDep{filename: f.filename, imp: path})
 		}
 	}
 	if len(derr.missing) > 0 {
-		return nil, nil, derr
+		return nil, nil, nil, derr
 	}
-	return depImports, stdImports, nil
+	return depImports, stdImports, relImports, nil
 }
 
-func buildImportcfgFile(archives []archive, stdImports []string, installSuffix, dir string) (string, error) {
+func buildImportcfgFile(archives []archive, stdImports []string, relImports map[string]string, installSuffix, dir string) (string, error) {
 	buf := &bytes.Buffer{}
 	goroot, ok := os.LookupEnv("GOROOT")
 	if !ok {
@@ -357,6 +593,16 @@ func buildImportcfgFile(archives []archive, stdImports []string, installSuffix,
 		}
 		fmt.Fprintf(buf, "packagefile %s=%s\n", arc.importMap, arc.file)
 	}
+	// The compiler looks up relative imports in the import map before
+	// resolving them against its working directory.
+	relPaths := make([]string, 0, len(relImports))
+	for rel := range relImports {
+		relPaths = append(relPaths, rel)
+	}
+	sort.Strings(relPaths)
+	for _, rel := range relPaths {
+		fmt.Fprintf(buf, "importmap %s=%s\n", rel, relImports[rel])
+	}
 	f, err := ioutil.TempFile(dir, "importcfg")
 	if err != nil {
 		return "", err
@@ -399,10 +645,24 @@ func (m *archiveMultiFlag) Set(v string) error {
 type depsError struct {
 	missing []missingDep
 	known   []string
+
+	// label is the label of the target being compiled. If set along with
+	// index, the error ends with a buildozer command that adds the missing
+	// dependencies.
+	label string
+
+	// index maps import paths of transitive dependencies to the labels of
+	// libraries that provide them. If set, the error suggests a label for
+	// each missing import.
+	index map[string][]string
 }
 
 type missingDep struct {
 	filename, imp string
+
+	// resolved is the import path a relative import resolved to. It is empty
+	// for other imports, and for relative imports that couldn't be resolved.
+	resolved string
 }
 
 var _ error = depsError{}
@@ -410,8 +670,35 @@ var _ error = depsError{}
 func (e depsError) Error() string {
 	buf := bytes.NewBuffer(nil)
 	fmt.Fprintf(buf, "missing strict dependencies:\n")
+	var fixLabels []string
+	fixSet := make(map[string]bool)
 	for _, dep := range e.missing {
-		fmt.Fprintf(buf, "\t%s: import of %q\n", dep.filename, dep.imp)
+		imp := dep.imp
+		if isRelative(dep.imp) {
+			if dep.resolved == "" {
+				fmt.Fprintf(buf, "\t%s: relative import of %q is outside the import path tree\n", dep.filename, dep.imp)
+				continue
+			}
+			fmt.Fprintf(buf, "\t%s: import of %q (resolved to %q)\n", dep.filename, dep.imp, dep.resolved)
+			imp = dep.resolved
+		} else {
+			fmt.Fprintf(buf, "\t%s: import of %q\n", dep.filename, dep.imp)
+		}
+		if e.index == nil {
+			continue
+		}
+		switch labels := e.index[imp]; len(labels) {
+		case 0:
+			fmt.Fprintf(buf, "\t\tno transitive dependency has importpath %q\n", imp)
+		case 1:
+			fmt.Fprintf(buf, "\t\tadd %s to deps\n", labels[0])
+			if !fixSet[labels[0]] {
+				fixSet[labels[0]] = true
+				fixLabels = append(fixLabels, labels[0])
+			}
+		default:
+			fmt.Fprintf(buf, "\t\tadd one of these libraries to deps: %s\n", strings.Join(labels, ", "))
+		}
 	}
 	if len(e.known) == 0 {
 		fmt.Fprintln(buf, "No dependencies were provided.")
@@ -422,9 +709,160 @@ func (e depsError) Error() string {
 		}
 	}
 	fmt.Fprint(buf, "Check that imports in Go sources match importpath attributes in deps.")
+	if e.label != "" && len(fixLabels) > 0 {
+		fmt.Fprintf(buf, "\nTo add the missing dependencies, run:\n\tbuildozer 'add deps %s' %s", strings.Join(fixLabels, " "), e.label)
+	}
 	return buf.String()
 }
 
+// readDepsIndex reads a file written by the compile action that maps import
+// paths of transitive dependencies to labels. Each line has the form
+// "importpath=label". An import path may be provided by more than one
+// library, for example, when libraries are vendored in several places.
+func readDepsIndex(path string) (map[string][]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || seen[line] {
+			continue
+		}
+		seen[line] = true
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s: badly formed line: %s", path, line)
+		}
+		index[parts[0]] = append(index[parts[0]], parts[1])
+	}
+	for _, labels := range index {
+		sort.Strings(labels)
+	}
+	return index, nil
+}
+
+// findUnusedDeps returns the archives whose import paths are not in
+// depImports, in the order they were given.
+func findUnusedDeps(archives []archive, depImports []string) []archive {
+	used := make(map[string]bool)
+	for _, imp := range depImports {
+		used[imp] = true
+	}
+	var unused []archive
+	for _, arc := range archives {
+		if !used[arc.importPath] {
+			unused = append(unused, arc)
+		}
+	}
+	return unused
+}
+
+type unusedDepsError struct {
+	unused []archive
+}
+
+var _ error = unusedDepsError{}
+
+func (e unusedDepsError) Error() string {
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "unused direct dependencies:\n")
+	for _, arc := range e.unused {
+		fmt.Fprintf(buf, "\t%s\n", arc.importPath)
+	}
+	fmt.Fprint(buf, "Check that these libraries are imported by Go sources, or remove them from deps.")
+	return buf.String()
+}
+
+// unusedDepsFile is the JSON document written to -unused_deps_out.
+type unusedDepsFile struct {
+	// Package is the package path (importmap) of the compiled package.
+	Package string `json:"package"`
+
+	// Unused lists the direct dependencies that aren't imported.
+	Unused []unusedDep `json:"unused"`
+}
+
+type unusedDep struct {
+	ImportPath string `json:"importpath"`
+	ImportMap  string `json:"importmap"`
+}
+
+func writeUnusedDeps(path, packagePath string, unused []archive) error {
+	f := unusedDepsFile{Package: packagePath, Unused: []unusedDep{}}
+	for _, arc := range unused {
+		f.Unused = append(f.Unused, unusedDep{ImportPath: arc.importPath, ImportMap: arc.importMap})
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0666)
+}
+
+// compileStats is the JSON document written to -stats.
+type compileStats struct {
+	// Package is the package path (importmap) of the compiled package.
+	Package string `json:"package"`
+
+	// GoFiles and AsmFiles are the numbers of .go and .s files that matched
+	// build constraints and were compiled.
+	GoFiles  int `json:"go_files"`
+	AsmFiles int `json:"asm_files"`
+
+	// DirectImports and StdlibImports are the numbers of distinct direct
+	// dependencies and standard library packages imported by those files.
+	DirectImports int `json:"direct_imports"`
+	StdlibImports int `json:"stdlib_imports"`
+
+	// CompileWallNs is the wall time of the compiler. NogoWallNs is the wall
+	// time of nogo, which runs concurrently, or 0 if nogo didn't run.
+	CompileWallNs int64 `json:"compile_wall_ns"`
+	NogoWallNs    int64 `json:"nogo_wall_ns"`
+}
+
+// newCompileStats returns the statistics for a package with the given numbers
+// of .go and .s files, which import depImports and stdImports. Imports may be
+// repeated. Times are left for the caller to fill in.
+func newCompileStats(packagePath string, goFiles, asmFiles int, depImports, stdImports []string) compileStats {
+	return compileStats{
+		Package:       packagePath,
+		GoFiles:       goFiles,
+		AsmFiles:      asmFiles,
+		DirectImports: countUnique(depImports),
+		StdlibImports: countUnique(stdImports),
+	}
+}
+
+func writeCompileStats(path string, stats compileStats) error {
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0666)
+}
+
+func countUnique(list []string) int {
+	set := make(map[string]bool)
+	for _, s := range list {
+		set[s] = true
+	}
+	return len(set)
+}
+
 func isRelative(path string) bool {
-	return strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../")
+	return path == "." || path == ".." || strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../")
+}
+
+// resolveRelativeImport joins a relative import path with the path of the
+// importing package, the same way the go command does in GOPATH mode. It
+// returns false if the result would be outside the import path tree.
+func resolveRelativeImport(packagePath, imp string) (string, bool) {
+	resolved := path.Join(packagePath, imp)
+	if resolved == "." || resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "", false
+	}
+	return resolved, true
 }
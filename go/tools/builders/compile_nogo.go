@@ -0,0 +1,45 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file is linked into the compile builder together with nogo's sources
+// and the analyzers generated by generate_nogo_main.go, when nogo is
+// configured with in_process = True. Analyzers then run in the compile
+// process, so no nogo process is started. The package is still parsed and
+// type checked for the analyzers separately from the compiler.
+
+package main
+
+import (
+	"io"
+	"sync"
+)
+
+func init() {
+	inProcessNogo = runNogoInProcess
+}
+
+var (
+	nogoInitOnce sync.Once
+	nogoInitErr  error
+)
+
+// runNogoInProcess runs nogo with args. Analyzers are initialized the first
+// time it's called; a persistent worker may call it many times.
+func runNogoInProcess(args []string, stderr io.Writer) error {
+	nogoInitOnce.Do(func() { nogoInitErr = initNogo() })
+	if nogoInitErr != nil {
+		return nogoInitErr
+	}
+	return runNogo(args, stderr)
+}
@@ -0,0 +1,125 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompileStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestCompileStats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a.go": `package stats
+
+import (
+	"fmt"
+	"os"
+
+	"example.com/dep"
+)
+`,
+		"b.go": `package stats
+
+import (
+	"fmt"
+
+	"example.com/dep"
+	"example.com/other"
+	"../sibling"
+)
+`,
+		"ignored.go": `// +build ignore
+
+package stats
+
+import "strings"
+`,
+		"asm.s":        "",
+		"packages.txt": "fmt\nos\nstrings\n",
+	}
+	var srcs []string
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if name != "packages.txt" {
+			srcs = append(srcs, path)
+		}
+	}
+
+	all, err := readFiles(build.Default, srcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var goFiles, sFiles []*goMetadata
+	for _, f := range all {
+		if strings.HasSuffix(f.filename, ".go") {
+			goFiles = append(goFiles, f)
+		} else {
+			sFiles = append(sFiles, f)
+		}
+	}
+	archives := []archive{
+		{importPath: "example.com/dep", importMap: "example.com/dep"},
+		{importPath: "example.com/other", importMap: "example.com/other"},
+		{importPath: "example.com/sibling", importMap: "example.com/sibling"},
+	}
+	depImports, stdImports, _, err := checkDirectDeps(goFiles, archives, filepath.Join(dir, "packages.txt"), "example.com/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := newCompileStats("example.com/stats", len(goFiles), len(sFiles), depImports, stdImports)
+	stats.CompileWallNs = (2 * time.Second).Nanoseconds()
+	stats.NogoWallNs = (3 * time.Second).Nanoseconds()
+	statsPath := filepath.Join(dir, "stats.json")
+	if err := writeCompileStats(statsPath, stats); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(statsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"package":         "example.com/stats",
+		"go_files":        float64(2),
+		"asm_files":       float64(1),
+		"direct_imports":  float64(3),
+		"stdlib_imports":  float64(2),
+		"compile_wall_ns": float64(2e9),
+		"nogo_wall_ns":    float64(3e9),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got stats %s; want %v", data, want)
+	}
+}
@@ -35,7 +35,7 @@ func run(args []string) error {
 	if err != nil {
 		return err
 	}
-	flags := flag.NewFlagSet("cover", flag.ExitOnError)
+	flags := flag.NewFlagSet("cover", flag.ContinueOnError)
 	var coverSrc, coverVar, origSrc, srcName string
 	flags.StringVar(&coverSrc, "o", "", "coverage output file")
 	flags.StringVar(&coverVar, "var", "", "name of cover variable")
@@ -144,7 +144,7 @@ func init() {
 func main() {
 	log.SetFlags(0)
 	log.SetPrefix("GoCover: ")
-	if err := run(os.Args[1:]); err != nil {
+	if err := runBuilder(os.Args[1:], run); err != nil {
 		log.Fatal(err)
 	}
 }
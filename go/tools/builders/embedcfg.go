@@ -0,0 +1,328 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// embedPattern is a pattern in a //go:embed directive.
+type embedPattern struct {
+	pattern string
+	pos     token.Position
+}
+
+// embedSrc is a file that may be embedded. rel is the file's path, relative
+// to the root of the source or output tree it's in. This is the same for
+// source and generated files in the same package.
+type embedSrc struct {
+	rel, path string
+}
+
+// embedSrcMultiFlag parses -embedsrc flags of the form "rel=path".
+type embedSrcMultiFlag []embedSrc
+
+func (m *embedSrcMultiFlag) String() string {
+	if m == nil || len(*m) == 0 {
+		return ""
+	}
+	return fmt.Sprint(*m)
+}
+
+func (m *embedSrcMultiFlag) Set(v string) error {
+	i := strings.IndexByte(v, '=')
+	if i <= 0 {
+		return fmt.Errorf("could not parse embed source %q: expected rel=path", v)
+	}
+	*m = append(*m, embedSrc{rel: v[:i], path: v[i+1:]})
+	return nil
+}
+
+// embedError reports a //go:embed pattern that can't be resolved.
+type embedError struct {
+	pos     token.Position
+	pattern string
+	msg     string
+}
+
+func (e *embedError) Error() string {
+	return fmt.Sprintf("%s: pattern %s: %s", e.pos, e.pattern, e.msg)
+}
+
+// buildEmbedcfgFile finds //go:embed directives in files that import
+// "embed", resolves their patterns against srcs, and writes a file in dir
+// that the compiler reads with -embedcfg. Patterns are relative to pkgDir,
+// the package directory relative to the root of the source or output tree.
+// buildEmbedcfgFile returns "" if there are no directives.
+func buildEmbedcfgFile(files []*goMetadata, srcs []embedSrc, pkgDir, dir string) (string, error) {
+	var patterns []embedPattern
+	for _, f := range files {
+		if !importsEmbed(f) {
+			continue
+		}
+		filePatterns, err := readEmbedPatterns(f.filename)
+		if err != nil {
+			return "", err
+		}
+		patterns = append(patterns, filePatterns...)
+	}
+	if len(patterns) == 0 {
+		return "", nil
+	}
+
+	// Find the files in the package directory and below, keyed by their
+	// paths relative to the package directory.
+	pkgFiles := make(map[string]string)
+	for _, src := range srcs {
+		rel := src.rel
+		if pkgDir != "." {
+			if !strings.HasPrefix(rel, pkgDir+"/") {
+				continue
+			}
+			rel = rel[len(pkgDir)+1:]
+		}
+		pkgFiles[rel] = abs(src.path)
+	}
+
+	cfg := struct {
+		Patterns map[string][]string
+		Files    map[string]string
+	}{
+		Patterns: make(map[string][]string),
+		Files:    make(map[string]string),
+	}
+	var errs []error
+	for _, p := range patterns {
+		if _, ok := cfg.Patterns[p.pattern]; ok {
+			continue
+		}
+		matches, err := resolveEmbed(p.pattern, pkgFiles)
+		if err != nil {
+			errs = append(errs, &embedError{pos: p.pos, pattern: p.pattern, msg: err.Error()})
+			continue
+		}
+		cfg.Patterns[p.pattern] = matches
+		for _, m := range matches {
+			cfg.Files[m] = pkgFiles[m]
+		}
+	}
+	if len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.Error()
+		}
+		return "", fmt.Errorf("invalid //go:embed patterns:\n\t%s\nFiles must be listed in embedsrcs to be embedded.", strings.Join(msgs, "\n\t"))
+	}
+
+	data, err := json.MarshalIndent(&cfg, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile(dir, "embedcfg")
+	if err != nil {
+		return "", err
+	}
+	filename := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return filename, err
+	}
+	return filename, f.Close()
+}
+
+func importsEmbed(f *goMetadata) bool {
+	for _, imp := range f.imports {
+		if imp == "embed" {
+			return true
+		}
+	}
+	return false
+}
+
+// readEmbedPatterns returns the patterns in //go:embed directives in a file.
+// The compiler checks where the directives are, so that's not done here.
+func readEmbedPatterns(filename string) ([]embedPattern, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	var patterns []embedPattern
+	for _, group := range f.Comments {
+		for _, c := range group.List {
+			if !strings.HasPrefix(c.Text, "//go:embed") {
+				continue
+			}
+			args := c.Text[len("//go:embed"):]
+			if args != "" && !unicode.IsSpace(rune(args[0])) {
+				continue
+			}
+			pos := fset.Position(c.Pos())
+			list, err := parseGoEmbed(args)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid //go:embed: %v", pos, err)
+			}
+			for _, p := range list {
+				patterns = append(patterns, embedPattern{pattern: p, pos: pos})
+			}
+		}
+	}
+	return patterns, nil
+}
+
+// parseGoEmbed parses the arguments of a //go:embed directive. Patterns are
+// separated by spaces and may be quoted with double quotes or back quotes.
+// Adapted from go/build/read.go.
+func parseGoEmbed(args string) ([]string, error) {
+	var list []string
+	for args = strings.TrimSpace(args); args != ""; args = strings.TrimSpace(args) {
+		var p string
+		switch args[0] {
+		default:
+			i := len(args)
+			for j, c := range args {
+				if unicode.IsSpace(c) {
+					i = j
+					break
+				}
+			}
+			p, args = args[:i], args[i:]
+
+		case '`':
+			i := strings.Index(args[1:], "`")
+			if i < 0 {
+				return nil, fmt.Errorf("invalid quoted string: %s", args)
+			}
+			p, args = args[1:1+i], args[1+i+1:]
+
+		case '"':
+			end := -1
+			for i := 1; i < len(args); i++ {
+				if args[i] == '\\' {
+					i++
+					continue
+				}
+				if args[i] == '"' {
+					end = i + 1
+					break
+				}
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("invalid quoted string: %s", args)
+			}
+			q, err := strconv.Unquote(args[:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted string: %s", args[:end])
+			}
+			p, args = q, args[end:]
+		}
+		if args != "" {
+			r, _ := utf8.DecodeRuneInString(args)
+			if !unicode.IsSpace(r) {
+				return nil, fmt.Errorf("invalid quoted string: %s", args)
+			}
+		}
+		list = append(list, p)
+	}
+	return list, nil
+}
+
+// resolveEmbed returns the files in pkgFiles matched by pattern, sorted.
+// A pattern matches a file if it matches the file's path or the path of one
+// of the directories containing it. Files in matched directories are only
+// included if no element of their path below that directory begins with
+// "." or "_", unless the pattern begins with "all:". This is the same as
+// go build.
+func resolveEmbed(pattern string, pkgFiles map[string]string) ([]string, error) {
+	glob, all := pattern, false
+	if strings.HasPrefix(glob, "all:") {
+		glob, all = glob[len("all:"):], true
+	}
+	if escapesPackage(glob) {
+		return nil, errors.New("cannot embed files outside the package directory")
+	}
+	if !validEmbedPattern(glob) {
+		return nil, errors.New("invalid pattern syntax")
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	for rel := range pkgFiles {
+		elems := strings.Split(rel, "/")
+		for i := 1; i <= len(elems); i++ {
+			if ok, _ := path.Match(glob, strings.Join(elems[:i], "/")); !ok {
+				continue
+			}
+			if i == len(elems) || all || !hasHiddenElem(elems[i:]) {
+				matches = append(matches, rel)
+			}
+			break
+		}
+	}
+	if len(matches) == 0 {
+		return nil, errors.New("no matching files found")
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func escapesPackage(glob string) bool {
+	if path.IsAbs(glob) || filepath.IsAbs(glob) {
+		return true
+	}
+	for _, elem := range strings.Split(glob, "/") {
+		if elem == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// validEmbedPattern reports whether glob is a clean, unrooted, slash-separated
+// path, as required by go:embed.
+func validEmbedPattern(glob string) bool {
+	if glob == "" || glob == "." {
+		return false
+	}
+	for _, elem := range strings.Split(glob, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+func hasHiddenElem(elems []string) bool {
+	for _, elem := range elems {
+		if strings.HasPrefix(elem, ".") || strings.HasPrefix(elem, "_") {
+			return true
+		}
+	}
+	return false
+}
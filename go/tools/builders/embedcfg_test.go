@@ -0,0 +1,157 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGoEmbed(t *testing.T) {
+	for _, test := range []struct {
+		args    string
+		want    []string
+		wantErr bool
+	}{
+		{args: " a.txt", want: []string{"a.txt"}},
+		{args: " a.txt\tb/*.html  c", want: []string{"a.txt", "b/*.html", "c"}},
+		{args: ` "with space.txt" b`, want: []string{"with space.txt", "b"}},
+		{args: " `raw string.txt` \"q\\x41\"", want: []string{"raw string.txt", "qA"}},
+		{args: ` "unterminated`, wantErr: true},
+		{args: " `unterminated", wantErr: true},
+		{args: ` "a"b`, wantErr: true},
+	} {
+		got, err := parseGoEmbed(test.args)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseGoEmbed(%q): got %q; want error", test.args, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseGoEmbed(%q): %v", test.args, err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseGoEmbed(%q): got %q; want %q", test.args, got, test.want)
+		}
+	}
+}
+
+func TestResolveEmbed(t *testing.T) {
+	pkgFiles := map[string]string{
+		"a.txt":                "",
+		"static/index.html":    "",
+		"static/.hidden":       "",
+		"static/_partial.html": "",
+		"static/css/site.css":  "",
+		".config":              "",
+	}
+	for _, test := range []struct {
+		pattern, wantErr string
+		want             []string
+	}{
+		{pattern: "a.txt", want: []string{"a.txt"}},
+		{pattern: "*.txt", want: []string{"a.txt"}},
+		{pattern: "static", want: []string{"static/css/site.css", "static/index.html"}},
+		{pattern: "all:static", want: []string{"static/.hidden", "static/_partial.html", "static/css/site.css", "static/index.html"}},
+		{pattern: "static/*", want: []string{"static/.hidden", "static/_partial.html", "static/css/site.css", "static/index.html"}},
+		{pattern: ".config", want: []string{".config"}},
+		{pattern: "missing.txt", wantErr: "no matching files found"},
+		{pattern: "../other/a.txt", wantErr: "cannot embed files outside the package directory"},
+		{pattern: "/etc/passwd", wantErr: "cannot embed files outside the package directory"},
+		{pattern: "./a.txt", wantErr: "invalid pattern syntax"},
+		{pattern: "static/", wantErr: "invalid pattern syntax"},
+		{pattern: "[", wantErr: "syntax error in pattern"},
+	} {
+		got, err := resolveEmbed(test.pattern, pkgFiles)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("resolveEmbed(%q): got %q, %v; want error containing %q", test.pattern, got, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("resolveEmbed(%q): %v", test.pattern, err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("resolveEmbed(%q): got %q; want %q", test.pattern, got, test.want)
+		}
+	}
+}
+
+func TestBuildEmbedcfgFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestBuildEmbedcfgFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "embed.go")
+	if err := ioutil.WriteFile(src, []byte(`package p
+
+import "embed"
+
+//go:embed hello.txt
+var hello string
+
+//go:embed static
+var static embed.FS
+`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	files := []*goMetadata{{filename: src, imports: []string{"embed"}}}
+	srcs := []embedSrc{
+		{rel: "pkg/hello.txt", path: "pkg/hello.txt"},
+		{rel: "pkg/static/gen.js", path: "bazel-out/bin/pkg/static/gen.js"},
+		{rel: "other/hello.txt", path: "other/hello.txt"},
+	}
+
+	name, err := buildEmbedcfgFile(files, srcs, "pkg", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg struct {
+		Patterns map[string][]string
+		Files    map[string]string
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	wantPatterns := map[string][]string{
+		"hello.txt": {"hello.txt"},
+		"static":    {"static/gen.js"},
+	}
+	if !reflect.DeepEqual(cfg.Patterns, wantPatterns) {
+		t.Errorf("got patterns %q; want %q", cfg.Patterns, wantPatterns)
+	}
+	wantFiles := map[string]string{
+		"hello.txt":     abs("pkg/hello.txt"),
+		"static/gen.js": abs("bazel-out/bin/pkg/static/gen.js"),
+	}
+	if !reflect.DeepEqual(cfg.Files, wantFiles) {
+		t.Errorf("got files %q; want %q", cfg.Files, wantFiles)
+	}
+
+	// Files outside the package directory can't be embedded.
+	if _, err := buildEmbedcfgFile(files, srcs[1:], "pkg", dir); err == nil || !strings.Contains(err.Error(), "embed.go:5:1: pattern hello.txt: no matching files found") {
+		t.Errorf("got error %v; want missing hello.txt", err)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"go/build"
 	"io"
 	"io/ioutil"
 	"os"
@@ -96,6 +97,70 @@ func (e *env) goCmd(cmd string, args ...string) []string {
 	return append([]string{exe, cmd}, args...)
 }
 
+// asmDefines returns -D flags for the assembler that define GOOS_$GOOS and
+// GOARCH_$GOARCH for the target platform, along with macros for the
+// architecture variant, like GOAMD64_v1 or GOARM_7, as "go build" does. This
+// lets assembly sources use #ifdef to select code for a platform. Variants
+// are read from the environment, with the same defaults as the go command.
+func asmDefines() []string {
+	goos, goarch := build.Default.GOOS, build.Default.GOARCH
+	defines := []string{"-D", "GOOS_" + goos, "-D", "GOARCH_" + goarch}
+	switch goarch {
+	case "386":
+		defines = append(defines, "-D", "GO386_"+getenvDefault("GO386", "sse2"))
+	case "amd64":
+		defines = append(defines, "-D", "GOAMD64_"+getenvDefault("GOAMD64", "v1"))
+	case "mips", "mipsle":
+		defines = append(defines, "-D", "GOMIPS_"+getenvDefault("GOMIPS", "hardfloat"))
+	case "mips64", "mips64le":
+		defines = append(defines, "-D", "GOMIPS64_"+getenvDefault("GOMIPS64", "hardfloat"))
+	case "ppc64", "ppc64le":
+		// Each version is treated as a superset of the versions before it.
+		switch getenvDefault("GOPPC64", "power8") {
+		case "power10":
+			defines = append(defines, "-D", "GOPPC64_power10")
+			fallthrough
+		case "power9":
+			defines = append(defines, "-D", "GOPPC64_power9")
+			fallthrough
+		default:
+			defines = append(defines, "-D", "GOPPC64_power8")
+		}
+	case "riscv64":
+		defines = append(defines, "-D", "GORISCV64_"+getenvDefault("GORISCV64", "rva20u64"))
+	case "arm":
+		// GOARM may include a floating point mode, like "7,hardfloat".
+		goarm := getenvDefault("GOARM", "7")
+		switch {
+		case strings.Contains(goarm, "7"):
+			defines = append(defines, "-D", "GOARM_7")
+			fallthrough
+		case strings.Contains(goarm, "6"):
+			defines = append(defines, "-D", "GOARM_6")
+			fallthrough
+		default:
+			defines = append(defines, "-D", "GOARM_5")
+		}
+	case "arm64":
+		// Large System Extensions are available from v8.1, or may be
+		// requested for v8.0 with an option, like "v8.0,lse".
+		goarm64 := getenvDefault("GOARM64", "v8.0")
+		if strings.Contains(goarm64, ",lse") || !strings.HasPrefix(goarm64, "v8.0") {
+			defines = append(defines, "-D", "GOARM64_LSE")
+		}
+	}
+	return defines
+}
+
+// getenvDefault returns the value of the environment variable key, or def
+// if it's not set or empty.
+func getenvDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
 // runCommand executes a subprocess that inherits stdout, stderr, and the
 // environment from this process.
 func (e *env) runCommand(args []string) error {
@@ -269,3 +334,23 @@ func formatCommand(w io.Writer, cmd *exec.Cmd) {
 	}
 	fmt.Fprint(w, "\n")
 }
+
+// goMinorVersion returns the minor version of the Go SDK. Builders are
+// compiled with the SDK they're used with, so this is the version of the
+// running binary. ok is false if the version can't be parsed; this is
+// probably a newer development version.
+func goMinorVersion() (minor int, ok bool) {
+	version := runtime.Version()
+	if !strings.HasPrefix(version, "go1.") {
+		return 0, false
+	}
+	version = version[len("go1."):]
+	if i := strings.IndexFunc(version, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		version = version[:i]
+	}
+	n, err := strconv.Atoi(version)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
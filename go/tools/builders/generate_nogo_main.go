@@ -22,12 +22,15 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"math"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"text/template"
 )
 
@@ -51,6 +54,32 @@ var analyzers = []*analysis.Analyzer{
 {{- end}}
 }
 
+// findingsFormat is the format of the file written by the -findings flag.
+const findingsFormat = {{printf "%q" .FindingsFormat}}
+
+// reportUnusedIgnores determines whether nogo:ignore directives that don't
+// suppress any diagnostics are reported.
+const reportUnusedIgnores = {{.ReportUnusedIgnores}}
+
+// vetEnabled determines whether nogo runs vet.
+const vetEnabled = {{.VetEnabled}}
+
+// vetChecks lists the vet checks that nogo runs. If empty, a default set of
+// checks is run.
+var vetChecks = []string{
+{{- range $check := .VetChecks}}
+	{{printf "%q" $check}},
+{{- end}}
+}
+
+// baseline maps diagnostics recorded in the baseline file to the number of
+// times they were recorded. They are not reported.
+var baseline = map[baselineEntry]int{
+{{- range $entry := .Baseline}}
+	{ {{- printf "%q, %q, %q, %q" $entry.Analyzer $entry.File $entry.Message $entry.Fingerprint -}} }: {{$entry.Count}},
+{{- end}}
+}
+
 // configs maps analysis names to configurations.
 var configs = map[string]config{
 {{- range $name, $config := .Configs}}
@@ -75,6 +104,18 @@ var configs = map[string]config{
 			{{- end}}
 		},
 		{{- end}}
+		{{- if eq $config.Severity "warning"}}
+		severity: severityWarning,
+		{{- else if eq $config.Severity "off"}}
+		severity: severityOff,
+		{{- end}}
+		{{- if $config.AnalyzerFlags}}
+		analyzerFlags: map[string]string{
+			{{- range $flag, $value := $config.AnalyzerFlags}}
+			{{printf "%q" $flag}}: {{printf "%q" $value}},
+			{{- end}}
+		},
+		{{- end}}
 	},
 {{- end}}
 }
@@ -86,12 +127,19 @@ func run(args []string) error {
 	out := flags.String("output", "", "output file to write (defaults to stdout)")
 	flags.Var(&analyzerImportPaths, "analyzer_importpath", "import path of an analyzer library")
 	configFile := flags.String("config", "", "nogo config file")
+	findingsFormat := flags.String("findings_format", "json", "format of the findings file written by nogo (json or sarif)")
+	reportUnusedIgnores := flags.Bool("report_unused_ignores", false, "whether nogo should report nogo:ignore directives that don't suppress anything")
+	baselineFile := flags.String("baseline", "", "file with diagnostics that nogo should not report")
+	vet := flags.Bool("vet", false, "whether nogo should run vet")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
 	if *out == "" {
 		return errors.New("must provide output file")
 	}
+	if *findingsFormat != "json" && *findingsFormat != "sarif" {
+		return fmt.Errorf("invalid findings format %q: must be json or sarif", *findingsFormat)
+	}
 
 	outFile := os.Stdout
 	var cErr error
@@ -109,6 +157,10 @@ func run(args []string) error {
 	if err != nil {
 		return err
 	}
+	baseline, err := readBaseline(*baselineFile)
+	if err != nil {
+		return err
+	}
 
 	type Import struct {
 		Path, Name string
@@ -126,12 +178,22 @@ func run(args []string) error {
 		suffix++
 	}
 	data := struct {
-		Imports    []Import
-		Configs    Configs
-		NeedRegexp bool
+		Imports             []Import
+		Configs             Configs
+		NeedRegexp          bool
+		FindingsFormat      string
+		ReportUnusedIgnores bool
+		Baseline            []BaselineCount
+		VetEnabled          bool
+		VetChecks           []string
 	}{
-		Imports: imports,
-		Configs: config,
+		Imports:             imports,
+		Configs:             config,
+		FindingsFormat:      *findingsFormat,
+		ReportUnusedIgnores: *reportUnusedIgnores,
+		Baseline:            baseline,
+		VetEnabled:          *vet,
+		VetChecks:           config[vetConfigName].Checks,
 	}
 	for _, c := range config {
 		if len(c.OnlyFiles) > 0 || len(c.ExcludeFiles) > 0 {
@@ -178,19 +240,101 @@ func buildConfig(path string) (Configs, error) {
 				return Configs{}, fmt.Errorf("invalid pattern for analysis %q: %v", name, err)
 			}
 		}
+		for flag := range config.AnalyzerFlags {
+			if flag == "" || strings.HasPrefix(flag, "-") || strings.Contains(flag, "=") {
+				return Configs{}, fmt.Errorf("invalid flag name for analysis %q: %q (flags must be named without a leading dash)", name, flag)
+			}
+		}
+		if len(config.Checks) > 0 && name != vetConfigName {
+			return Configs{}, fmt.Errorf("invalid config for analysis %q: checks may only be set for %q", name, vetConfigName)
+		}
+		switch config.Severity {
+		case "", "error", "warning", "off":
+		default:
+			return Configs{}, fmt.Errorf("invalid severity for analysis %q: %q (must be error, warning, or off)", name, config.Severity)
+		}
 		configs[name] = Config{
 			// Description is currently unused.
-			OnlyFiles:    config.OnlyFiles,
-			ExcludeFiles: config.ExcludeFiles,
+			OnlyFiles:     config.OnlyFiles,
+			ExcludeFiles:  config.ExcludeFiles,
+			Severity:      config.Severity,
+			Checks:        config.Checks,
+			AnalyzerFlags: config.AnalyzerFlags,
 		}
 	}
 	return configs, nil
 }
 
+// vetConfigName is the name of the configuration entry that lists the checks
+// run by vet.
+const vetConfigName = "vet"
+
 type Configs map[string]Config
 
 type Config struct {
-	Description  string
-	OnlyFiles    map[string]string `json:"only_files"`
-	ExcludeFiles map[string]string `json:"exclude_files"`
+	Description   string
+	OnlyFiles     map[string]string `json:"only_files"`
+	ExcludeFiles  map[string]string `json:"exclude_files"`
+	Severity      string            `json:"severity"`
+	Checks        []string          `json:"checks"`
+	AnalyzerFlags map[string]string `json:"analyzer_flags"`
+}
+
+// readBaseline reads a baseline file written by nogo and counts how many
+// times each entry occurs. Entries are returned in a stable order, so the
+// generated source is deterministic.
+func readBaseline(path string) ([]BaselineCount, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline file: %v", err)
+	}
+	defer f.Close()
+	counts := make(map[BaselineEntry]int)
+	dec := json.NewDecoder(f)
+	for {
+		var e BaselineEntry
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal baseline file: %v", err)
+		}
+		if e.Analyzer == "" || e.File == "" {
+			return nil, fmt.Errorf("invalid baseline entry %+v: analyzer and file must be set", e)
+		}
+		counts[e]++
+	}
+	baseline := make([]BaselineCount, 0, len(counts))
+	for e, n := range counts {
+		baseline = append(baseline, BaselineCount{BaselineEntry: e, Count: n})
+	}
+	sort.Slice(baseline, func(i, j int) bool {
+		a, b := baseline[i], baseline[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Analyzer != b.Analyzer {
+			return a.Analyzer < b.Analyzer
+		}
+		if a.Message != b.Message {
+			return a.Message < b.Message
+		}
+		return a.Fingerprint < b.Fingerprint
+	})
+	return baseline, nil
+}
+
+// BaselineEntry must be kept in sync with baselineEntry in nogo_baseline.go.
+type BaselineEntry struct {
+	Analyzer    string `json:"analyzer"`
+	File        string `json:"file"`
+	Message     string `json:"message"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+type BaselineCount struct {
+	BaselineEntry
+	Count int
 }
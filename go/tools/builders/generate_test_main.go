@@ -52,28 +52,35 @@ type Example struct {
 
 // Cases holds template data.
 type Cases struct {
-	RunDir     string
-	Imports    []*Import
-	Tests      []TestCase
-	Benchmarks []TestCase
-	Examples   []Example
-	TestMain   string
-	Coverage   bool
+	Pkgname      string
+	RunDir       string
+	ShardTimings string
+	Imports      []*Import
+	Tests        []TestCase
+	Benchmarks   []TestCase
+	FuzzTargets  []TestCase
+	Examples     []Example
+	TestMain     string
+	Coverage     bool
+	Fuzzing      bool
 }
 
 var codeTpl = `
 package main
 import (
-	"flag"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"testing"
 	"testing/internal/testdeps"
 
+	"github.com/bazelbuild/rules_go/go/tools/bzltestutil"
+
 {{if .Coverage}}
+	"flag"
+
 	"github.com/bazelbuild/rules_go/go/tools/coverdata"
 {{end}}
 
@@ -88,43 +95,162 @@ var allTests = []testing.InternalTest{
 {{end}}
 }
 
-var benchmarks = []testing.InternalBenchmark{
+var allBenchmarks = []testing.InternalBenchmark{
 {{range .Benchmarks}}
 	{"{{.Name}}", {{.Package}}.{{.Name}} },
 {{end}}
 }
 
-var examples = []testing.InternalExample{
+{{if .Fuzzing}}
+var allFuzzTargets = []testing.InternalFuzzTarget{
+{{range .FuzzTargets}}
+	{"{{.Name}}", {{.Package}}.{{.Name}} },
+{{end}}
+}
+{{end}}
+
+var allExamples = []testing.InternalExample{
 {{range .Examples}}
 	{Name: "{{.Name}}", F: {{.Package}}.{{.Name}}, Output: {{printf "%q" .Output}}, Unordered: {{.Unordered}} },
 {{end}}
 }
 
-func testsInShard() []testing.InternalTest {
-	totalShards, err := strconv.Atoi(os.Getenv("TEST_TOTAL_SHARDS"))
-	if err != nil || totalShards <= 1 {
-		return allTests
+// shardTimings is the path to a file with the time each test took in earlier
+// runs, relative to the runfiles directory of the workspace, or "".
+var shardTimings = {{printf "%q" .ShardTimings}}
+
+// testNames returns the names of the tests, examples, {{if .Fuzzing}}and fuzz targets, {{end}}which are
+// selected by -test.run.
+func testNames() []string {
+	var names []string
+	for _, t := range allTests {
+		names = append(names, t.Name)
+	}
+	for _, e := range allExamples {
+		names = append(names, e.Name)
+	}
+	{{if .Fuzzing}}
+	for _, f := range allFuzzTargets {
+		names = append(names, f.Name)
+	}
+	{{end}}
+	return names
+}
+
+func benchmarkNames() []string {
+	var names []string
+	for _, b := range allBenchmarks {
+		names = append(names, b.Name)
 	}
-	shardIndex, err := strconv.Atoi(os.Getenv("TEST_SHARD_INDEX"))
-	if err != nil || shardIndex < 0 {
-		return allTests
+	return names
+}
+
+// inShard returns the tests, benchmarks, {{if .Fuzzing}}fuzz targets, {{end}}and examples that should run in
+// this shard. They're distributed together, so each shard does about the same
+// amount of work. Benchmarks are only distributed if they're enabled.
+{{- if .Fuzzing}}
+func inShard() ([]testing.InternalTest, []testing.InternalBenchmark, []testing.InternalFuzzTarget, []testing.InternalExample) {
+{{- else}}
+func inShard() ([]testing.InternalTest, []testing.InternalBenchmark, []testing.InternalExample) {
+{{- end}}
+	names := testNames()
+	benchmarking := bzltestutil.BenchmarksEnabled(os.Args[1:])
+	if benchmarking {
+		names = append(names, benchmarkNames()...)
+	}
+	timings := ""
+	if shardTimings != "" {
+		timings = filepath.Join(os.Getenv("TEST_SRCDIR"), os.Getenv("TEST_WORKSPACE"), filepath.FromSlash(shardTimings))
+	}
+	in, err := bzltestutil.InShard(names, timings)
+	if err != nil {
+		log.Printf("warning: %v", err)
 	}
+
 	tests := []testing.InternalTest{}
-	for i, t := range allTests {
-		if i % totalShards == shardIndex {
+	for _, t := range allTests {
+		if in[0] {
 			tests = append(tests, t)
 		}
+		in = in[1:]
+	}
+	examples := []testing.InternalExample{}
+	for _, e := range allExamples {
+		if in[0] {
+			examples = append(examples, e)
+		}
+		in = in[1:]
 	}
-	return tests
+	{{if .Fuzzing}}
+	fuzzTargets := []testing.InternalFuzzTarget{}
+	for _, f := range allFuzzTargets {
+		if in[0] {
+			fuzzTargets = append(fuzzTargets, f)
+		}
+		in = in[1:]
+	}
+	{{end}}
+	benchmarks := allBenchmarks
+	if benchmarking {
+		benchmarks = []testing.InternalBenchmark{}
+		for _, b := range allBenchmarks {
+			if in[0] {
+				benchmarks = append(benchmarks, b)
+			}
+			in = in[1:]
+		}
+	}
+	return tests, benchmarks, {{if .Fuzzing}}fuzzTargets, {{end}}examples
 }
 
 func main() {
+	// When Bazel asks for a test report, run the tests in a subprocess and
+	// convert its verbose output to the report. This must happen before changing directories,
+	// since the path to the binary may be relative.
+	if bzltestutil.ShouldWrap() {
+		err := bzltestutil.Wrap({{printf "%q" .Pkgname}})
+		if xerr, ok := err.(*exec.ExitError); ok {
+			// ExitError.ExitCode requires go1.12. syscall.WaitStatus has
+			// ExitStatus on most platforms.
+			code := 1
+			if ws, ok := xerr.Sys().(interface{ ExitStatus() int }); ok && ws.ExitStatus() > 0 {
+				code = ws.ExitStatus()
+			}
+			os.Exit(code)
+		} else if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	// Translate Bazel's test filter and GO_TEST_BENCH to flags. Flags on the
+	// command line come later, so they take precedence.
+	filterArgs, warnings, err := bzltestutil.FilterArgs(testNames(), benchmarkNames())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, w := range warnings {
+		log.Printf("warning: %s", w)
+	}
+	os.Args = append(append([]string{os.Args[0]}, filterArgs...), os.Args[1:]...)
+
 	// Check if we're being run by Bazel and change directories if so.
 	// TEST_SRCDIR and TEST_WORKSPACE are set by the Bazel test runner, so that makes a decent proxy.
 	testSrcdir := os.Getenv("TEST_SRCDIR")
 	testWorkspace := os.Getenv("TEST_WORKSPACE")
 	if testSrcdir != "" && testWorkspace != "" {
 		abs := filepath.Join(testSrcdir, testWorkspace, {{printf "%q" .RunDir}})
+		{{if .Fuzzing}}
+		// When fuzzing, run in a copy of the test directory where new
+		// crashers can be written to testdata/fuzz.
+		if bzltestutil.FuzzingEnabled(os.Args[1:]) {
+			dir, err := bzltestutil.SetupFuzzing(abs)
+			if err != nil {
+				log.Fatalf("could not set up fuzzing: %v", err)
+			}
+			abs = dir
+		}
+		{{end}}
 		err := os.Chdir(abs)
 		// Ignore the Chdir err when on Windows, since it might have have runfiles symlinks.
 		// https://github.com/bazelbuild/rules_go/pull/1721#issuecomment-422145904
@@ -136,12 +262,6 @@ func main() {
 		}
 	}
 
-	if filter := os.Getenv("TESTBRIDGE_TEST_ONLY"); filter != "" {
-		if f := flag.Lookup("test.run"); f != nil {
-			f.Value.Set(filter)
-		}
-	}
-
 	{{if .Coverage}}
 	if len(coverdata.Cover.Counters) > 0 {
 		testing.RegisterCover(coverdata.Cover)
@@ -153,7 +273,13 @@ func main() {
 	}
 	{{end}}
 
-	m := testing.MainStart(testdeps.TestDeps{}, testsInShard(), benchmarks, examples)
+	{{if .Fuzzing}}
+	tests, benchmarks, fuzzTargets, examples := inShard()
+	m := testing.MainStart(testdeps.TestDeps{}, tests, benchmarks, fuzzTargets, examples)
+	{{else}}
+	tests, benchmarks, examples := inShard()
+	m := testing.MainStart(testdeps.TestDeps{}, tests, benchmarks, examples)
+	{{end}}
 	{{if not .TestMain}}
 	os.Exit(m.Run())
 	{{else}}
@@ -175,6 +301,7 @@ func run(args []string) error {
 	runDir := flags.String("rundir", ".", "Path to directory where tests should run.")
 	out := flags.String("output", "", "output file to write. Defaults to stdout.")
 	coverage := flags.Bool("coverage", false, "whether coverage is supported")
+	shardTimings := flags.String("shard_timings", "", "Path to a file with the time each test took in earlier runs, relative to the runfiles directory of the workspace.")
 	flags.Var(&imports, "import", "Packages to import")
 	flags.Var(&sources, "src", "Sources to process for tests")
 	if err := flags.Parse(args); err != nil {
@@ -222,8 +349,18 @@ func run(args []string) error {
 	}
 
 	cases := Cases{
-		RunDir:   strings.Replace(filepath.FromSlash(*runDir), `\`, `\\`, -1),
-		Coverage: *coverage,
+		RunDir:       strings.Replace(filepath.FromSlash(*runDir), `\`, `\\`, -1),
+		Coverage:     *coverage,
+		ShardTimings: *shardTimings,
+	}
+	// Fuzz targets are only supported starting with go1.18, which added a
+	// parameter for them to testing.MainStart.
+	if minor, ok := goMinorVersion(); !ok || minor >= 18 {
+		cases.Fuzzing = true
+	}
+	if imp, ok := importMap["l"]; ok {
+		// Test reports are named after the package under test.
+		cases.Pkgname = imp.Path
 	}
 
 	testFileSet := token.NewFileSet()
@@ -278,7 +415,7 @@ func run(args []string) error {
 			}
 
 			// 3. The only parameter should have a type identified as
-			//    *<something>.T
+			//    *<something>.T, *<something>.B, or *<something>.F
 			starExpr, ok := fn.Type.Params.List[0].Type.(*ast.StarExpr)
 			if !ok {
 				continue
@@ -313,6 +450,16 @@ func run(args []string) error {
 					Name:    fn.Name.Name,
 				})
 			}
+			if strings.HasPrefix(fn.Name.Name, "Fuzz") && cases.Fuzzing {
+				if selExpr.Sel.Name != "F" {
+					continue
+				}
+				pkgs[pkg] = true
+				cases.FuzzTargets = append(cases.FuzzTargets, TestCase{
+					Package: pkg,
+					Name:    fn.Name.Name,
+				})
+			}
 		}
 	}
 	// Add only the imports we found tests for
@@ -0,0 +1,124 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Suppresses diagnostics that were recorded in a baseline file, so that new
+// analyzers can be enabled without fixing every existing finding first.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// baselineEntry identifies a diagnostic in a baseline file. Baseline files
+// contain one JSON-encoded entry per line, so the files written for each
+// package may simply be concatenated.
+//
+// Entries don't include line numbers, so they still match after unrelated
+// edits move code around. Instead, Fingerprint is a hash of the source line
+// the diagnostic was reported on, with whitespace normalized.
+type baselineEntry struct {
+	Analyzer    string `json:"analyzer"`
+	File        string `json:"file"`
+	Message     string `json:"message"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// applyBaseline removes diagnostics recorded in the baseline compiled into
+// nogo. If an entry is recorded n times, at most n matching diagnostics are
+// removed, so new occurrences of a known problem are still reported.
+// Entries for all diagnostics, including removed ones, are returned so a new
+// baseline may be written.
+func applyBaseline(pkg *goPackage, diagnostics []diagnosticEntry) ([]diagnosticEntry, []baselineEntry) {
+	entries := make([]baselineEntry, 0, len(diagnostics))
+	remaining := make(map[baselineEntry]int, len(baseline))
+	for e, n := range baseline {
+		remaining[e] = n
+	}
+	sources := make(map[string][]byte)
+	kept := diagnostics[:0]
+	for _, d := range diagnostics {
+		p := pkg.fset.Position(d.Pos)
+		src, ok := sources[p.Filename]
+		if !ok {
+			// Errors are ignored; the fingerprint of an unreadable file is the
+			// hash of an empty line.
+			src, _ = ioutil.ReadFile(p.Filename)
+			sources[p.Filename] = src
+		}
+		e := baselineEntry{
+			Analyzer:    d.Analyzer.Name,
+			File:        p.Filename,
+			Message:     d.Message,
+			Fingerprint: fingerprint(src, p.Offset),
+		}
+		entries = append(entries, e)
+		if remaining[e] > 0 {
+			remaining[e]--
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return kept, entries
+}
+
+// fingerprint returns a hash of the line in src containing offset.
+func fingerprint(src []byte, offset int) string {
+	if offset < 0 || offset > len(src) {
+		offset = len(src)
+	}
+	start := bytes.LastIndexByte(src[:offset], '\n') + 1
+	end := bytes.IndexByte(src[offset:], '\n')
+	if end < 0 {
+		end = len(src)
+	} else {
+		end += offset
+	}
+	line := strings.Join(strings.Fields(string(src[start:end])), " ")
+	sum := sha256.Sum256([]byte(line))
+	return hex.EncodeToString(sum[:8])
+}
+
+// writeBaseline writes entries to path, one per line, in a stable order.
+func writeBaseline(path string, entries []baselineEntry) error {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Analyzer != b.Analyzer {
+			return a.Analyzer < b.Analyzer
+		}
+		if a.Message != b.Message {
+			return a.Message < b.Message
+		}
+		return a.Fingerprint < b.Fingerprint
+	})
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0666)
+}
@@ -0,0 +1,35 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Entry point for the nogo binary. This file is not linked into the compile
+// builder when nogo runs in the same process (see compile_nogo.go).
+
+package main
+
+import (
+	"log"
+	"os"
+)
+
+func main() {
+	log.SetFlags(0) // no timestamp
+	log.SetPrefix("nogo: ")
+	if err := initNogo(); err != nil {
+		log.Fatal(err)
+	}
+	if err := runNogo(os.Args[1:], os.Stderr); err != nil {
+		log.Fatal(err)
+	}
+}
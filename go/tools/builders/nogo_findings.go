@@ -0,0 +1,283 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Writes the diagnostics found by nogo in a machine-readable format, so they
+// can be consumed by tools other than the build log (code review annotations,
+// dashboards, and so on).
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// findingsFile is the JSON document written for each package analyzed
+// by nogo when the findings format is "json".
+type findingsFile struct {
+	// Package is the package path (importmap) of the analyzed package.
+	Package string `json:"package"`
+
+	// Findings is the list of diagnostics reported for the package, sorted
+	// by position.
+	Findings []finding `json:"findings"`
+}
+
+// finding is a single diagnostic reported by an analyzer. Posn is nil if
+// the diagnostic's position isn't known, for example, when vet reports a
+// diagnostic in a file nogo didn't load.
+type finding struct {
+	Analyzer       string         `json:"analyzer"`
+	Severity       string         `json:"severity"`
+	Category       string         `json:"category,omitempty"`
+	Posn           *position      `json:"posn,omitempty"`
+	End            *position      `json:"end,omitempty"`
+	Message        string         `json:"message"`
+	Related        []relatedInfo  `json:"related,omitempty"`
+	SuggestedFixes []suggestedFix `json:"suggested_fixes,omitempty"`
+}
+
+// position is a resolved source position. Line and Column are 1-based;
+// Offset is a 0-based byte offset into the file.
+type position struct {
+	Filename string `json:"filename"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Offset   int    `json:"offset"`
+}
+
+type relatedInfo struct {
+	Posn    position  `json:"posn"`
+	End     *position `json:"end,omitempty"`
+	Message string    `json:"message"`
+}
+
+type suggestedFix struct {
+	Message string     `json:"message"`
+	Edits   []textEdit `json:"edits"`
+}
+
+// textEdit replaces the text between Posn and End with NewText.
+type textEdit struct {
+	Posn    position `json:"posn"`
+	End     position `json:"end"`
+	NewText string   `json:"new_text"`
+}
+
+// writeFindings writes findings for the package with the given path to
+// a file. format may be "json" or "sarif". docs maps the names of analyzers
+// to their documentation, which is used to describe SARIF rules.
+func writeFindings(path, format, packagePath string, findings []finding, docs map[string]string) error {
+	if findings == nil {
+		// Always write a list, even when empty, so consumers don't need to
+		// distinguish null.
+		findings = []finding{}
+	}
+	var v interface{}
+	switch format {
+	case "", "json":
+		v = findingsFile{Package: packagePath, Findings: findings}
+	case "sarif":
+		v = newSarifLog(findings, docs)
+	default:
+		return fmt.Errorf("unknown findings format %q", format)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0666)
+}
+
+// The types below describe the subset of the SARIF 2.1.0 format that nogo
+// emits. See https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html.
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://raw.githubusercontent.com/oasis-tcs/sarif-spec/master/Schemata/sarif-schema-2.1.0.json"
+)
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules,omitempty"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID           string            `json:"ruleId"`
+	Level            string            `json:"level"`
+	Message          sarifMessage      `json:"message"`
+	Locations        []sarifLocation   `json:"locations"`
+	RelatedLocations []sarifLocation   `json:"relatedLocations,omitempty"`
+	Fixes            []sarifFix        `json:"fixes,omitempty"`
+	Properties       map[string]string `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	ID               int                   `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+type sarifFix struct {
+	Description     sarifMessage          `json:"description"`
+	ArtifactChanges []sarifArtifactChange `json:"artifactChanges"`
+}
+
+type sarifArtifactChange struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Replacements     []sarifReplacement    `json:"replacements"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion   sarifRegion   `json:"deletedRegion"`
+	InsertedContent *sarifMessage `json:"insertedContent,omitempty"`
+}
+
+// newSarifLog converts findings into a SARIF log with a single run. docs
+// maps the names of analyzers to their documentation.
+func newSarifLog(findings []finding, docs map[string]string) sarifLog {
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: "nogo"}},
+		Results: []sarifResult{},
+	}
+
+	seenRules := make(map[string]bool)
+	for _, f := range findings {
+		if !seenRules[f.Analyzer] {
+			seenRules[f.Analyzer] = true
+			doc := docs[f.Analyzer]
+			if i := strings.Index(doc, "\n"); i >= 0 {
+				doc = doc[:i]
+			}
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+				ID:               f.Analyzer,
+				ShortDescription: sarifMessage{Text: doc},
+			})
+		}
+
+		result := sarifResult{
+			RuleID:    f.Analyzer,
+			Level:     f.Severity,
+			Message:   sarifMessage{Text: f.Message},
+			Locations: []sarifLocation{},
+		}
+		if f.Posn != nil {
+			result.Locations = append(result.Locations, sarifLocation{PhysicalLocation: sarifPhysical(*f.Posn, f.End)})
+		}
+		if f.Category != "" {
+			result.Properties = map[string]string{"category": f.Category}
+		}
+		for i, r := range f.Related {
+			result.RelatedLocations = append(result.RelatedLocations, sarifLocation{
+				ID:               i + 1,
+				PhysicalLocation: sarifPhysical(r.Posn, r.End),
+				Message:          &sarifMessage{Text: r.Message},
+			})
+		}
+		for _, sf := range f.SuggestedFixes {
+			result.Fixes = append(result.Fixes, sarifFixFor(sf))
+		}
+		run.Results = append(run.Results, result)
+	}
+	sort.Slice(run.Tool.Driver.Rules, func(i, j int) bool {
+		return run.Tool.Driver.Rules[i].ID < run.Tool.Driver.Rules[j].ID
+	})
+
+	return sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs:    []sarifRun{run},
+	}
+}
+
+func sarifPhysical(start position, end *position) sarifPhysicalLocation {
+	region := sarifRegion{StartLine: start.Line, StartColumn: start.Column}
+	if end != nil {
+		region.EndLine, region.EndColumn = end.Line, end.Column
+	}
+	return sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{URI: start.Filename},
+		Region:           region,
+	}
+}
+
+func sarifFixFor(sf suggestedFix) sarifFix {
+	fix := sarifFix{Description: sarifMessage{Text: sf.Message}}
+	changes := make(map[string]int) // file name to index in fix.ArtifactChanges
+	for _, e := range sf.Edits {
+		i, ok := changes[e.Posn.Filename]
+		if !ok {
+			i = len(fix.ArtifactChanges)
+			changes[e.Posn.Filename] = i
+			fix.ArtifactChanges = append(fix.ArtifactChanges, sarifArtifactChange{
+				ArtifactLocation: sarifArtifactLocation{URI: e.Posn.Filename},
+			})
+		}
+		r := sarifReplacement{DeletedRegion: sarifRegion{
+			StartLine:   e.Posn.Line,
+			StartColumn: e.Posn.Column,
+			EndLine:     e.End.Line,
+			EndColumn:   e.End.Column,
+		}}
+		if e.NewText != "" {
+			r.InsertedContent = &sarifMessage{Text: e.NewText}
+		}
+		fix.ArtifactChanges[i].Replacements = append(fix.ArtifactChanges[i].Replacements, r)
+	}
+	return fix
+}
@@ -0,0 +1,83 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFindingsWithoutPosition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWriteFindingsWithoutPosition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	findings := []finding{
+		{
+			Analyzer: "printf",
+			Severity: "error",
+			Posn:     &position{Filename: "foo/foo.go", Line: 5, Column: 2, Offset: 40},
+			Message:  "with position",
+		}, {
+			Analyzer: "printf",
+			Severity: "error",
+			Message:  "without position",
+		},
+	}
+	docs := map[string]string{"printf": "check printf calls\n\nMore details."}
+	for _, tc := range []struct {
+		format   string
+		want     []string
+		dontWant []string
+	}{
+		{
+			format:   "json",
+			want:     []string{`"line": 5`, `"message": "without position"`},
+			dontWant: []string{`"line": 0`, `"filename": ""`},
+		}, {
+			format:   "sarif",
+			want:     []string{`"startLine": 5`, `"locations": []`, `"text": "check printf calls"`},
+			dontWant: []string{`"startLine": 0`, `"uri": ""`},
+		},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			path := filepath.Join(dir, tc.format)
+			if err := writeFindings(path, tc.format, "example.com/foo", findings, docs); err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := string(data)
+			for _, want := range tc.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("findings do not contain %s; got:\n%s", want, got)
+				}
+			}
+			for _, dontWant := range tc.dontWant {
+				if strings.Contains(got, dontWant) {
+					t.Errorf("findings contain %s; got:\n%s", dontWant, got)
+				}
+			}
+		})
+	}
+}
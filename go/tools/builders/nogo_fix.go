@@ -0,0 +1,283 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Applies the suggested fixes reported by analyzers and writes the result
+// as a unified diff that can be applied with "patch -p0" from the execution
+// root (which is the workspace root for files in the main repository).
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines printed around each change.
+const diffContext = 3
+
+// fileEdit replaces the bytes in [start, end) with newText.
+type fileEdit struct {
+	start, end int
+	newText    string
+}
+
+// overlaps reports whether e and other can't both be applied.
+// Identical edits don't overlap, so the same fix may be suggested twice.
+func (e fileEdit) overlaps(other fileEdit) bool {
+	if e == other {
+		return false
+	}
+	if e.start == e.end && other.start == other.end {
+		// Two insertions at the same point would be applied in an
+		// unpredictable order.
+		return e.start == other.start
+	}
+	return e.start < other.end && other.start < e.end
+}
+
+// writeFixes computes the edits suggested for findings and writes them as a
+// unified diff to path. Only the first suggested fix of each finding is
+// considered. Fixes whose edits overlap each other or a fix already accepted
+// are dropped as a whole; their descriptions are returned so they can be
+// reported.
+func writeFixes(path string, findings []finding) (skipped []string, err error) {
+	editsByFile := make(map[string][]fileEdit)
+	for _, f := range findings {
+		if len(f.SuggestedFixes) == 0 {
+			continue
+		}
+		fix := f.SuggestedFixes[0]
+		conflict := false
+	check:
+		for i, te := range fix.Edits {
+			if te.Posn.Filename != te.End.Filename {
+				conflict = true
+				break
+			}
+			e := fileEdit{start: te.Posn.Offset, end: te.End.Offset, newText: te.NewText}
+			for _, accepted := range editsByFile[te.Posn.Filename] {
+				if e.overlaps(accepted) {
+					conflict = true
+					break check
+				}
+			}
+			for _, other := range fix.Edits[:i] {
+				o := fileEdit{start: other.Posn.Offset, end: other.End.Offset, newText: other.NewText}
+				if other.Posn.Filename == te.Posn.Filename && e.overlaps(o) {
+					conflict = true
+					break check
+				}
+			}
+		}
+		if conflict {
+			posn := "-"
+			if f.Posn != nil {
+				posn = fmt.Sprintf("%s:%d:%d", f.Posn.Filename, f.Posn.Line, f.Posn.Column)
+			}
+			skipped = append(skipped, fmt.Sprintf("%s: %s: conflicting fix %q was not applied", posn, f.Analyzer, fix.Message))
+			continue
+		}
+		for _, te := range fix.Edits {
+			e := fileEdit{start: te.Posn.Offset, end: te.End.Offset, newText: te.NewText}
+			editsByFile[te.Posn.Filename] = appendUniqueEdit(editsByFile[te.Posn.Filename], e)
+		}
+	}
+
+	filenames := make([]string, 0, len(editsByFile))
+	for filename := range editsByFile {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	buf := &bytes.Buffer{}
+	for _, filename := range filenames {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		edits := editsByFile[filename]
+		sort.Slice(edits, func(i, j int) bool {
+			if edits[i].start != edits[j].start {
+				return edits[i].start < edits[j].start
+			}
+			return edits[i].end < edits[j].end
+		})
+		for _, e := range edits {
+			if e.start < 0 || e.end < e.start || e.end > len(src) {
+				return nil, fmt.Errorf("%s: suggested edit [%d, %d) is out of range", filename, e.start, e.end)
+			}
+		}
+		writeUnifiedDiff(buf, filename, string(src), edits)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		return nil, err
+	}
+	return skipped, nil
+}
+
+func appendUniqueEdit(edits []fileEdit, e fileEdit) []fileEdit {
+	for _, other := range edits {
+		if other == e {
+			return edits
+		}
+	}
+	return append(edits, e)
+}
+
+// hunkChange is a run of lines in the old file that is replaced by new lines.
+type hunkChange struct {
+	oldStart, oldEnd int // 0-based, half-open range of old lines
+	newLines         []string
+}
+
+// writeUnifiedDiff writes a diff between src and the result of applying edits
+// to src. edits must be sorted and must not overlap.
+func writeUnifiedDiff(buf *bytes.Buffer, filename, src string, edits []fileEdit) {
+	lines := splitLines(src)
+	lineStarts := make([]int, len(lines)+1)
+	for i, l := range lines {
+		lineStarts[i+1] = lineStarts[i] + len(l)
+	}
+	// lineOf returns the index of the line containing offset. An offset at the
+	// end of a file that ends with a newline refers to an empty, virtual line
+	// at index len(lines).
+	lineOf := func(offset int) int {
+		return sort.Search(len(lines), func(i int) bool {
+			return lineStarts[i+1] > offset || (i == len(lines)-1 && !strings.HasSuffix(lines[i], "\n"))
+		})
+	}
+
+	// Group edits that touch the same lines, and compute the new text for each
+	// group of lines.
+	var changes []hunkChange
+	for i := 0; i < len(edits); {
+		first := lineOf(edits[i].start)
+		last := lineOf(lastEditOffset(edits[i]))
+		j := i + 1
+		for ; j < len(edits) && lineOf(edits[j].start) <= last; j++ {
+			if l := lineOf(lastEditOffset(edits[j])); l > last {
+				last = l
+			}
+		}
+		oldEnd := last + 1
+		if oldEnd > len(lines) {
+			oldEnd = len(lines)
+		}
+		regionStart, regionEnd := lineStarts[first], lineStarts[oldEnd]
+		var text strings.Builder
+		pos := regionStart
+		for _, e := range edits[i:j] {
+			text.WriteString(src[pos:e.start])
+			text.WriteString(e.newText)
+			pos = e.end
+		}
+		text.WriteString(src[pos:regionEnd])
+		changes = append(changes, hunkChange{
+			oldStart: first,
+			oldEnd:   oldEnd,
+			newLines: splitLines(text.String()),
+		})
+		i = j
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	fmt.Fprintf(buf, "--- %s\n+++ %s\n", filename, filename)
+	delta := 0 // number of lines added before the current hunk
+	for i := 0; i < len(changes); {
+		j := i + 1
+		for ; j < len(changes) && changes[j].oldStart-changes[j-1].oldEnd <= 2*diffContext; j++ {
+		}
+		start := changes[i].oldStart - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := changes[j-1].oldEnd + diffContext
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		var body bytes.Buffer
+		oldCount, newCount := 0, 0
+		pos := start
+		for _, c := range changes[i:j] {
+			for ; pos < c.oldStart; pos++ {
+				writeDiffLine(&body, ' ', lines[pos])
+				oldCount++
+				newCount++
+			}
+			for ; pos < c.oldEnd; pos++ {
+				writeDiffLine(&body, '-', lines[pos])
+				oldCount++
+			}
+			for _, l := range c.newLines {
+				writeDiffLine(&body, '+', l)
+				newCount++
+			}
+		}
+		for ; pos < end; pos++ {
+			writeDiffLine(&body, ' ', lines[pos])
+			oldCount++
+			newCount++
+		}
+
+		oldStart, newStart := start+1, start+1+delta
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+		fmt.Fprintf(buf, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		buf.Write(body.Bytes())
+		delta += newCount - oldCount
+		i = j
+	}
+}
+
+// lastEditOffset returns the offset of the last byte replaced by e, or the
+// insertion point if e doesn't replace anything.
+func lastEditOffset(e fileEdit) int {
+	if e.end > e.start {
+		return e.end - 1
+	}
+	return e.start
+}
+
+// splitLines splits s into lines, keeping the line terminators.
+func splitLines(s string) []string {
+	var lines []string
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			lines = append(lines, s)
+			break
+		}
+		lines = append(lines, s[:i+1])
+		s = s[i+1:]
+	}
+	return lines
+}
+
+func writeDiffLine(buf *bytes.Buffer, prefix byte, line string) {
+	buf.WriteByte(prefix)
+	buf.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		buf.WriteString("\n\\ No newline at end of file\n")
+	}
+}
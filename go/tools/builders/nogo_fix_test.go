@@ -0,0 +1,183 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFixes(t *testing.T) {
+	var numbers strings.Builder
+	for i := 1; i <= 20; i++ {
+		fmt.Fprintf(&numbers, "l%d\n", i)
+	}
+
+	// Each fix is a list of edits, which replace the first occurrence of old
+	// in the source with newText.
+	type edit struct {
+		old, newText string
+	}
+	for _, tc := range []struct {
+		desc        string
+		src         string
+		fixes       [][]edit
+		want        string
+		wantSkipped int
+	}{
+		{
+			desc:  "single_edit",
+			src:   "a\nb\nc\n",
+			fixes: [][]edit{{{"b", "B"}}},
+			want: `@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`,
+		}, {
+			desc:  "multiple_hunks",
+			src:   numbers.String(),
+			fixes: [][]edit{{{"l2\n", "two\n"}}, {{"l19\n", "nineteen\n"}}},
+			want: `@@ -1,5 +1,5 @@
+ l1
+-l2
++two
+ l3
+ l4
+ l5
+@@ -16,5 +16,5 @@
+ l16
+ l17
+ l18
+-l19
++nineteen
+ l20
+`,
+		}, {
+			desc:  "nearby_edits_share_hunk",
+			src:   numbers.String(),
+			fixes: [][]edit{{{"l2\n", "two\n"}, {"l5\n", "five\n"}}},
+			want: `@@ -1,8 +1,8 @@
+ l1
+-l2
++two
+ l3
+ l4
+-l5
++five
+ l6
+ l7
+ l8
+`,
+		}, {
+			desc:  "no_trailing_newline",
+			src:   "a\nb",
+			fixes: [][]edit{{{"b", "c"}}},
+			want: `@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++c
+\ No newline at end of file
+`,
+		}, {
+			desc:        "overlap_within_fix",
+			src:         "a\nbcd\ne\n",
+			fixes:       [][]edit{{{"bc", "X"}, {"cd", "Y"}}},
+			wantSkipped: 1,
+		}, {
+			desc:  "overlap_across_fixes",
+			src:   "a\nbcd\ne\n",
+			fixes: [][]edit{{{"bc", "X"}}, {{"cd", "Y"}}},
+			want: `@@ -1,3 +1,3 @@
+ a
+-bcd
++Xd
+ e
+`,
+			wantSkipped: 1,
+		}, {
+			desc:  "duplicate_fix",
+			src:   "a\nb\nc\n",
+			fixes: [][]edit{{{"b", "B"}}, {{"b", "B"}}},
+			want: `@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "TestWriteFixes")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			src := filepath.Join(dir, "src.go")
+			if err := ioutil.WriteFile(src, []byte(tc.src), 0666); err != nil {
+				t.Fatal(err)
+			}
+
+			var findings []finding
+			for _, fix := range tc.fixes {
+				sf := suggestedFix{Message: "fix"}
+				for _, e := range fix {
+					start := strings.Index(tc.src, e.old)
+					if start < 0 {
+						t.Fatalf("%q not found in source", e.old)
+					}
+					sf.Edits = append(sf.Edits, textEdit{
+						Posn:    position{Filename: src, Offset: start},
+						End:     position{Filename: src, Offset: start + len(e.old)},
+						NewText: e.newText,
+					})
+				}
+				findings = append(findings, finding{
+					Analyzer:       "test",
+					Posn:           &position{Filename: src, Line: 1, Column: 1},
+					Message:        "message",
+					SuggestedFixes: []suggestedFix{sf},
+				})
+			}
+
+			patch := filepath.Join(dir, "fixes.patch")
+			skipped, err := writeFixes(patch, findings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(skipped) != tc.wantSkipped {
+				t.Errorf("got skipped fixes %q; want %d", skipped, tc.wantSkipped)
+			}
+			got, err := ioutil.ReadFile(patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := ""
+			if tc.want != "" {
+				want = fmt.Sprintf("--- %s\n+++ %s\n%s", src, src, tc.want)
+			}
+			if string(got) != want {
+				t.Errorf("got patch:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
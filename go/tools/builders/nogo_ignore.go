@@ -0,0 +1,212 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Suppresses diagnostics with //nogo:ignore comments in source files.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// ignorePrefix starts a comment that suppresses diagnostics. The full syntax
+// is:
+//
+//	//nogo:ignore analyzer1,analyzer2 reason
+//
+// A reason is required.
+const ignorePrefix = "//nogo:ignore"
+
+// ignoreAnalyzer is used to report problems with //nogo:ignore directives.
+// It is never run; its diagnostics are produced by nogo itself. Its severity
+// may be set in the nogo config like any other analyzer.
+var ignoreAnalyzer = &analysis.Analyzer{
+	Name: "nogo",
+	Doc:  "reports malformed and unused nogo:ignore directives",
+}
+
+// ignoreDirective is a //nogo:ignore comment. It suppresses diagnostics
+// from the named analyzers on the line where it appears and within the
+// declaration it documents, if any.
+type ignoreDirective struct {
+	pos       token.Pos
+	filename  string
+	line      int
+	analyzers []string
+
+	// declStart and declEnd delimit the declaration documented by the
+	// directive. They are token.NoPos if the directive isn't part of a doc
+	// comment.
+	declStart, declEnd token.Pos
+
+	// used records which analyzers had diagnostics suppressed by this directive.
+	used map[string]bool
+}
+
+func (d *ignoreDirective) suppresses(fset *token.FileSet, e diagnosticEntry) bool {
+	named := false
+	for _, name := range d.analyzers {
+		if name == e.Analyzer.Name {
+			named = true
+			break
+		}
+	}
+	if !named {
+		return false
+	}
+	if d.declStart.IsValid() && d.declStart <= e.Pos && e.Pos < d.declEnd {
+		return true
+	}
+	p := fset.Position(e.Pos)
+	return p.Filename == d.filename && p.Line == d.line
+}
+
+// applyIgnoreDirectives removes diagnostics suppressed by //nogo:ignore
+// directives in the package's source files. ran is the set of analyzers that
+// ran successfully. unfiltered has every diagnostic those analyzers reported,
+// before the nogo configuration was applied, and diagnostics has those that
+// remain. A directive is used if it matches a diagnostic in unfiltered, even
+// if the configuration dropped it. Diagnostics are appended for malformed
+// directives and, if reportUnusedIgnores is set, for directives that
+// suppress nothing.
+func applyIgnoreDirectives(pkg *goPackage, ran map[string]bool, unfiltered, diagnostics []diagnosticEntry) []diagnosticEntry {
+	directives, problems := parseIgnoreDirectives(pkg.fset, pkg.syntax)
+	if len(directives) == 0 && len(problems) == 0 {
+		return diagnostics
+	}
+
+	for _, e := range unfiltered {
+		for _, d := range directives {
+			if d.suppresses(pkg.fset, e) {
+				d.used[e.Analyzer.Name] = true
+			}
+		}
+	}
+	kept := diagnostics[:0]
+	for _, e := range diagnostics {
+		suppressed := false
+		for _, d := range directives {
+			if d.suppresses(pkg.fset, e) {
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			kept = append(kept, e)
+		}
+	}
+
+	if reportUnusedIgnores {
+		for _, d := range directives {
+			for _, name := range d.analyzers {
+				if ran[name] && !d.used[name] {
+					problems = append(problems, analysis.Diagnostic{
+						Pos:     d.pos,
+						Message: fmt.Sprintf("nogo:ignore directive for %s does not suppress any diagnostics", name),
+					})
+				}
+			}
+		}
+	}
+
+	severity := configs[ignoreAnalyzer.Name].severity
+	if severity == severityOff {
+		return kept
+	}
+	for _, p := range problems {
+		kept = append(kept, diagnosticEntry{Diagnostic: p, Analyzer: ignoreAnalyzer, severity: severity})
+	}
+	return kept
+}
+
+// parseIgnoreDirectives finds //nogo:ignore comments in files. Diagnostics
+// are returned for malformed comments, which are otherwise ignored.
+func parseIgnoreDirectives(fset *token.FileSet, files []*ast.File) ([]*ignoreDirective, []analysis.Diagnostic) {
+	var directives []*ignoreDirective
+	var problems []analysis.Diagnostic
+	for _, f := range files {
+		// Find the declarations documented by each comment group.
+		declRanges := make(map[*ast.CommentGroup][2]token.Pos)
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Doc != nil {
+					declRanges[decl.Doc] = [2]token.Pos{decl.Pos(), decl.End()}
+				}
+			case *ast.GenDecl:
+				if decl.Doc != nil {
+					declRanges[decl.Doc] = [2]token.Pos{decl.Pos(), decl.End()}
+				}
+				for _, spec := range decl.Specs {
+					var doc *ast.CommentGroup
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						doc = spec.Doc
+					case *ast.ValueSpec:
+						doc = spec.Doc
+					}
+					if doc != nil {
+						declRanges[doc] = [2]token.Pos{spec.Pos(), spec.End()}
+					}
+				}
+			}
+		}
+
+		for _, group := range f.Comments {
+			for _, c := range group.List {
+				if !strings.HasPrefix(c.Text, ignorePrefix) {
+					continue
+				}
+				rest := c.Text[len(ignorePrefix):]
+				if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+					// Some other directive that happens to share a prefix.
+					continue
+				}
+				fields := strings.Fields(rest)
+				if len(fields) < 2 {
+					problems = append(problems, analysis.Diagnostic{
+						Pos:     c.Pos(),
+						Message: "nogo:ignore directive must list analyzers and give a reason, for example: //nogo:ignore printf,shadow reason",
+					})
+					continue
+				}
+				var names []string
+				for _, name := range strings.Split(fields[0], ",") {
+					if name != "" {
+						names = append(names, name)
+					}
+				}
+				p := fset.Position(c.Pos())
+				d := &ignoreDirective{
+					pos:       c.Pos(),
+					filename:  p.Filename,
+					line:      p.Line,
+					analyzers: names,
+					used:      make(map[string]bool),
+				}
+				if r, ok := declRanges[group]; ok {
+					d.declStart, d.declEnd = r[0], r[1]
+				}
+				directives = append(directives, d)
+			}
+		}
+	}
+	return directives, problems
+}
@@ -21,6 +21,8 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/gob"
 	"errors"
 	"flag"
 	"fmt"
@@ -28,46 +30,92 @@ import (
 	"go/parser"
 	"go/token"
 	"go/types"
+	"io"
 	"io/ioutil"
-	"log"
 	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
+	"runtime/pprof"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/tools/go/analysis"
 	"golang.org/x/tools/go/analysis/internal/facts"
 	"golang.org/x/tools/go/gcexportdata"
 )
 
-func init() {
-	if err := analysis.Validate(analyzers); err != nil {
-		log.Fatal(err)
+// initNogo sets the flags of the analyzers linked into nogo, checks that
+// they're valid, and registers their fact types. It must be called once,
+// before runNogo.
+func initNogo() error {
+	if err := setAnalyzerFlags(analyzers); err != nil {
+		return err
 	}
-}
-
-func main() {
-	log.SetFlags(0) // no timestamp
-	log.SetPrefix("nogo: ")
-	if err := run(os.Args[1:]); err != nil {
-		log.Fatal(err)
+	if err := analysis.Validate(analyzers); err != nil {
+		return err
 	}
+	registerFactTypes(analyzers)
+	return nil
 }
 
-// run returns an error if there is a problem loading the package or if any
-// analysis fails.
-func run(args []string) error {
+// runNogo returns an error if there is a problem loading the package or if any
+// analysis fails. Warnings and other messages that don't fail the build are
+// written to stderr.
+func runNogo(args []string, stderr io.Writer) error {
 	stdImports := multiFlag{}
-	flags := flag.NewFlagSet("nogo", flag.ExitOnError)
+	flags := flag.NewFlagSet("nogo", flag.ContinueOnError)
 	flags.Var(&stdImports, "stdimport", "A standard library import path")
 	importcfg := flags.String("importcfg", "", "The import configuration file")
+	manifest := flags.String("manifest", "", "An importcfg file listing packages to analyze with packagedir directives, instead of a single package")
+	gopath := flags.String("gopath", "", "A directory produced by go_path containing packages to analyze, instead of a single package")
 	packagePath := flags.String("p", "", "The package path (importmap) of the package being compiled")
 	xPath := flags.String("x", "", "The file where serialized facts should be written")
-	flags.Parse(args)
+	vetTool := flags.String("vet_tool", "", "The vet binary, used when nogo is configured to run vet")
+	vetxPath := flags.String("vetx", "", "The file where facts computed by vet should be written")
+	findingsPath := flags.String("findings", "", "The file where diagnostics should be written in a machine-readable format")
+	fixesPath := flags.String("fixes", "", "The file where suggested fixes should be written as a unified diff")
+	baselinePath := flags.String("baseline", "", "The file where diagnostics should be written in baseline format")
+	profilePath := flags.String("profile", "", "The file where the time used by each analyzer should be written")
+	cpuProfilePath := flags.String("cpuprofile", "", "The file where a pprof CPU profile should be written")
+	stdlibFacts := flags.String("stdlib_facts", "", "A directory containing facts computed for the standard library")
+	factsOnly := flags.Bool("facts_only", false, "Only compute facts; don't report diagnostics")
+	factsFiles := multiFlag{}
+	flags.Var(&factsFiles, "facts", "Package path of a dependency and the file with its serialized facts, separated by '='")
+	vetxFiles := multiFlag{}
+	flags.Var(&vetxFiles, "vet_facts", "Package path of a dependency and the file with facts computed for it by vet, separated by '='")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
 	srcs := flags.Args()
 
+	if *cpuProfilePath != "" {
+		f, err := os.Create(*cpuProfilePath)
+		if err != nil {
+			return fmt.Errorf("error creating CPU profile: %v", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return fmt.Errorf("error starting CPU profile: %v", err)
+		}
+		defer func() {
+			pprof.StopCPUProfile()
+			f.Close()
+		}()
+	}
+	var prof *packageProfile
+	if *profilePath != "" {
+		prof = &packageProfile{Package: *packagePath}
+	}
+
+	if *manifest != "" || *gopath != "" {
+		// Analyze many packages without compiling them. Positional arguments
+		// are patterns matching the packages to report diagnostics for.
+		return runStandalone(*manifest, *gopath, srcs, *stdlibFacts)
+	}
+
 	packageFile, importMap, err := readImportCfg(*importcfg)
 	if err != nil {
 		return fmt.Errorf("error parsing importcfg: %v", err)
@@ -77,30 +125,191 @@ func run(args []string) error {
 		stdImportSet[i] = true
 	}
 
-	diagnostics, facts, err := checkPackage(analyzers, *packagePath, packageFile, importMap, stdImportSet, srcs)
+	imp := newImporter(importMap, packageFile, stdImportSet, *stdlibFacts)
+	if imp.factsFile, err = parseFactsFlags("facts", factsFiles); err != nil {
+		return err
+	}
+	if imp.vetxFile, err = parseFactsFlags("vet_facts", vetxFiles); err != nil {
+		return err
+	}
+	if *factsOnly {
+		// Only analyzers that export facts (and those they require) need to
+		// run. Vet is skipped, and diagnostics are discarded.
+		_, _, _, _, facts, err := checkPackage(factAnalyzers(analyzers), *packagePath, imp, srcs, nil, "", "", false, prof)
+		if err != nil {
+			return fmt.Errorf("error running analyzers: %v", err)
+		}
+		if err := ioutil.WriteFile(*xPath, facts, 0666); err != nil {
+			return fmt.Errorf("error writing facts: %v", err)
+		}
+		return nil
+	}
+
+	diagnostics, warnings, findings, baselineEntries, facts, err := checkPackage(analyzers, *packagePath, imp, srcs, enabledVetChecks(), *vetTool, *vetxPath, *fixesPath != "", prof)
 	if err != nil {
 		return fmt.Errorf("error running analyzers: %v", err)
 	}
-	if diagnostics != "" {
-		return fmt.Errorf("errors found by nogo during build-time code analysis:\n%s\n", diagnostics)
+	if prof != nil {
+		if err := writeProfile(*profilePath, prof); err != nil {
+			return fmt.Errorf("error writing profile: %v", err)
+		}
+	}
+	if *vetxPath != "" {
+		// vet doesn't run for every package, but Bazel expects the file to exist.
+		if _, err := os.Stat(*vetxPath); os.IsNotExist(err) {
+			if err := ioutil.WriteFile(*vetxPath, nil, 0666); err != nil {
+				return fmt.Errorf("error writing vet facts: %v", err)
+			}
+		}
+	}
+	if *baselinePath != "" {
+		if err := writeBaseline(*baselinePath, baselineEntries); err != nil {
+			return fmt.Errorf("error writing baseline: %v", err)
+		}
+	}
+	if *findingsPath != "" {
+		if err := writeFindings(*findingsPath, findingsFormat, *packagePath, findings, analyzerDocs()); err != nil {
+			return fmt.Errorf("error writing findings: %v", err)
+		}
 	}
+	if *fixesPath != "" {
+		skipped, err := writeFixes(*fixesPath, findings)
+		if err != nil {
+			return fmt.Errorf("error writing fixes: %v", err)
+		}
+		for _, s := range skipped {
+			fmt.Fprintln(stderr, s)
+		}
+	}
+	// Facts are written even if there are diagnostics, since the build may
+	// continue when nogo is run in fix mode.
 	if *xPath != "" {
 		if err := ioutil.WriteFile(*xPath, facts, 0666); err != nil {
 			return fmt.Errorf("error writing facts: %v", err)
 		}
 	}
+	if warnings != "" {
+		// Warnings are printed by the compile builder when nogo succeeds.
+		fmt.Fprintf(stderr, "warnings found by nogo during build-time code analysis:\n%s\n", warnings)
+	}
+	if diagnostics != "" {
+		if *baselinePath != "" {
+			// Diagnostics are recorded in the baseline instead of failing the
+			// build. Other errors above still fail it.
+			fmt.Fprintf(stderr, "errors found by nogo during build-time code analysis, recorded in the baseline:\n%s\n", diagnostics)
+			return nil
+		}
+		return fmt.Errorf("errors found by nogo during build-time code analysis:\n%s\n", diagnostics)
+	}
 
 	return nil
 }
 
+// registerFactTypes registers the fact types of analyzers (and the analyzers
+// they require) with gob, which is used to serialize facts.
+func registerFactTypes(analyzers []*analysis.Analyzer) {
+	seen := make(map[*analysis.Analyzer]bool)
+	var visit func(a *analysis.Analyzer)
+	visit = func(a *analysis.Analyzer) {
+		if seen[a] {
+			return
+		}
+		seen[a] = true
+		for _, f := range a.FactTypes {
+			gob.Register(f)
+		}
+		for _, req := range a.Requires {
+			visit(req)
+		}
+	}
+	for _, a := range analyzers {
+		visit(a)
+	}
+}
+
+// factAnalyzers returns the analyzers that export facts. Analyzers they
+// require are run as needed by checkPackage.
+func factAnalyzers(analyzers []*analysis.Analyzer) []*analysis.Analyzer {
+	var withFacts []*analysis.Analyzer
+	for _, a := range analyzers {
+		if len(a.FactTypes) > 0 {
+			withFacts = append(withFacts, a)
+		}
+	}
+	return withFacts
+}
+
+// setAnalyzerFlags sets the flags of analyzers (and the analyzers they
+// require) to the values in their configurations. Flags configured for
+// analyzers that aren't linked into nogo are ignored, like the rest of their
+// configuration, but flags the analyzers don't declare are reported.
+func setAnalyzerFlags(analyzers []*analysis.Analyzer) error {
+	seen := make(map[*analysis.Analyzer]bool)
+	var visit func(a *analysis.Analyzer) error
+	visit = func(a *analysis.Analyzer) error {
+		if seen[a] {
+			return nil
+		}
+		seen[a] = true
+		flags := configs[a.Name].analyzerFlags
+		names := make([]string, 0, len(flags))
+		for name := range flags {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if a.Flags.Lookup(name) == nil {
+				return fmt.Errorf("invalid analyzer_flags for analyzer %q: it has no flag %q", a.Name, name)
+			}
+			if err := a.Flags.Set(name, flags[name]); err != nil {
+				return fmt.Errorf("invalid analyzer_flags for analyzer %q: %v", a.Name, err)
+			}
+		}
+		for _, req := range a.Requires {
+			if err := visit(req); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, a := range analyzers {
+		if err := visit(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseFactsFlags maps package paths to facts files, given the values of a
+// flag named name. Each value has the form "packagepath=file".
+func parseFactsFlags(name string, values []string) (map[string]string, error) {
+	files := make(map[string]string)
+	for _, v := range values {
+		i := strings.Index(v, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid -%s flag %q: must be packagepath=file", name, v)
+		}
+		files[v[:i]] = v[i+1:]
+	}
+	return files, nil
+}
+
 // Adapted from go/src/cmd/compile/internal/gc/main.go. Keep in sync.
 func readImportCfg(file string) (packageFile map[string]string, importMap map[string]string, err error) {
-	packageFile, importMap = make(map[string]string), make(map[string]string)
 	data, err := ioutil.ReadFile(file)
 	if err != nil {
 		return nil, nil, fmt.Errorf("-importcfg: %v", err)
 	}
+	packageFile, importMap, _, err = parseImportCfg(file, data, false)
+	return packageFile, importMap, err
+}
 
+// parseImportCfg parses the contents of an importcfg file. If
+// allowPackageDir is true, "packagedir path=dir" directives are also
+// accepted; these are used by the standalone driver to list packages that
+// should be loaded from source.
+func parseImportCfg(file string, data []byte, allowPackageDir bool) (packageFile, importMap, packageDir map[string]string, err error) {
+	packageFile, importMap, packageDir = make(map[string]string), make(map[string]string), make(map[string]string)
 	for lineNum, line := range strings.Split(string(data), "\n") {
 		lineNum++ // 1-based
 		line = strings.TrimSpace(line)
@@ -120,32 +329,48 @@ func readImportCfg(file string) (packageFile map[string]string, importMap map[st
 		}
 		switch verb {
 		default:
-			return nil, nil, fmt.Errorf("%s:%d: unknown directive %q", file, lineNum, verb)
+			return nil, nil, nil, fmt.Errorf("%s:%d: unknown directive %q", file, lineNum, verb)
 		case "importmap":
 			if before == "" || after == "" {
-				return nil, nil, fmt.Errorf(`%s:%d: invalid importmap: syntax is "importmap old=new"`, file, lineNum)
+				return nil, nil, nil, fmt.Errorf(`%s:%d: invalid importmap: syntax is "importmap old=new"`, file, lineNum)
 			}
 			importMap[before] = after
 		case "packagefile":
 			if before == "" || after == "" {
-				return nil, nil, fmt.Errorf(`%s:%d: invalid packagefile: syntax is "packagefile path=filename"`, file, lineNum)
+				return nil, nil, nil, fmt.Errorf(`%s:%d: invalid packagefile: syntax is "packagefile path=filename"`, file, lineNum)
 			}
 			packageFile[before] = after
+		case "packagedir":
+			if !allowPackageDir {
+				return nil, nil, nil, fmt.Errorf("%s:%d: unknown directive %q", file, lineNum, verb)
+			}
+			if before == "" || after == "" {
+				return nil, nil, nil, fmt.Errorf(`%s:%d: invalid packagedir: syntax is "packagedir path=dir"`, file, lineNum)
+			}
+			packageDir[before] = after
 		}
 	}
-	return packageFile, importMap, nil
+	return packageFile, importMap, packageDir, nil
 }
 
-// checkPackage runs all the given analyzers on the specified package and
-// returns the source code diagnostics that the must be printed in the build log.
-// It returns an empty string if no source code diagnostics need to be printed.
+// checkPackage runs all the given analyzers on the specified package, along
+// with the given vet checks, and returns the source code diagnostics that
+// the must be printed in the build log, split into errors and warnings.
+// It returns empty strings if no source code diagnostics need to be printed.
+// The diagnostics are also returned in structured form, so they can be
+// written to a findings file, and as baseline entries. Baseline entries
+// include diagnostics suppressed by the baseline. If prof is not nil,
+// statistics about each analyzer are recorded in it.
 //
 // This implementation was adapted from that of golang.org/x/tools/go/checker/internal/checker.
-func checkPackage(analyzers []*analysis.Analyzer, packagePath string, packageFile, importMap map[string]string, stdImports map[string]bool, filenames []string) (string, []byte, error) {
-	imp := newImporter(importMap, packageFile, stdImports)
+func checkPackage(analyzers []*analysis.Analyzer, packagePath string, imp *importer, filenames []string, checks []string, vetTool, vetxPath string, fixing bool, prof *packageProfile) (string, string, []finding, []baselineEntry, []byte, error) {
+	loadStart := time.Now()
 	pkg, err := load(packagePath, imp, filenames)
 	if err != nil {
-		return "", nil, fmt.Errorf("error loading package: %v", err)
+		return "", "", nil, nil, nil, fmt.Errorf("error loading package: %v", err)
+	}
+	if prof != nil {
+		prof.LoadNs = time.Since(loadStart).Nanoseconds()
 	}
 
 	// Construct the action graph.
@@ -168,14 +393,119 @@ func checkPackage(analyzers []*analysis.Analyzer, packagePath string, packageFil
 	}
 
 	for _, analyzer := range analyzers {
+		if configs[analyzer.Name].severity == severityOff {
+			continue
+		}
 		action := visit(analyzer)
 		roots = append(roots, action)
 	}
 
+	// Run vet concurrently with the analyzers. Each vet check is treated as
+	// an action, so its diagnostics are handled the same way.
+	var vetActions []*action
+	var vetErr error
+	var vetWg sync.WaitGroup
+	if len(checks) > 0 {
+		if vetTool == "" {
+			return "", "", nil, nil, nil, errors.New("nogo is configured to run vet, but -vet_tool was not set")
+		}
+		vetWg.Add(1)
+		go func() {
+			defer vetWg.Done()
+			vetStart := time.Now()
+			vetActions, vetErr = runVet(vetTool, checks, pkg, packagePath, imp.packageFile, imp.importMap, imp.vetxFile, imp.stdImports, filenames, vetxPath)
+			if prof != nil {
+				prof.VetNs = time.Since(vetStart).Nanoseconds()
+			}
+		}()
+	}
 	execAll(roots)
-	diagnostics := checkAnalysisResults(roots, pkg)
+	vetWg.Wait()
+	if vetErr != nil {
+		return "", "", nil, nil, nil, fmt.Errorf("error running vet: %v", vetErr)
+	}
+	roots = append(roots, vetActions...)
+	if prof != nil {
+		all := make([]*action, 0, len(actions)+len(vetActions))
+		for _, act := range actions {
+			all = append(all, act)
+		}
+		prof.addActions(append(all, vetActions...))
+	}
+
+	diagnostics, warnings, entries, baselineEntries, err := checkAnalysisResults(roots, pkg, fixing)
+	if err != nil {
+		// Diagnostics from other analyzers are still printed, but the action
+		// fails even if they would only be recorded in a baseline.
+		if diagnostics != "" {
+			err = fmt.Errorf("%v\n%s", err, diagnostics)
+		}
+		return "", "", nil, nil, nil, err
+	}
+	findings := newFindings(pkg.fset, entries)
 	facts := pkg.facts.Encode()
-	return diagnostics, facts, nil
+	return diagnostics, warnings, findings, baselineEntries, facts, nil
+}
+
+// newFindings converts diagnostics into findings, resolving their positions
+// with fset.
+func newFindings(fset *token.FileSet, entries []diagnosticEntry) []finding {
+	findings := make([]finding, 0, len(entries))
+	resolve := func(pos token.Pos) position {
+		p := fset.Position(pos)
+		return position{Filename: p.Filename, Line: p.Line, Column: p.Column, Offset: p.Offset}
+	}
+	resolveValid := func(pos token.Pos) *position {
+		if !pos.IsValid() {
+			return nil
+		}
+		p := resolve(pos)
+		return &p
+	}
+	for _, e := range entries {
+		f := finding{
+			Analyzer: e.Analyzer.Name,
+			Severity: e.severity.String(),
+			Category: e.Category,
+			Posn:     resolveValid(e.Pos),
+			End:      resolveValid(e.End),
+			Message:  e.Message,
+		}
+		for _, r := range e.Related {
+			f.Related = append(f.Related, relatedInfo{
+				Posn:    resolve(r.Pos),
+				End:     resolveValid(r.End),
+				Message: r.Message,
+			})
+		}
+		for _, sf := range e.SuggestedFixes {
+			fix := suggestedFix{Message: sf.Message}
+			for _, te := range sf.TextEdits {
+				end := te.End
+				if !end.IsValid() {
+					end = te.Pos
+				}
+				fix.Edits = append(fix.Edits, textEdit{
+					Posn:    resolve(te.Pos),
+					End:     resolve(end),
+					NewText: string(te.NewText),
+				})
+			}
+			f.SuggestedFixes = append(f.SuggestedFixes, fix)
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// analyzerDocs maps the names of analyzers that may report diagnostics to
+// their documentation.
+func analyzerDocs() map[string]string {
+	docs := map[string]string{ignoreAnalyzer.Name: ignoreAnalyzer.Doc}
+	for _, a := range analyzers {
+		docs[a.Name] = a.Doc
+	}
+	return docs
 }
 
 // An action represents one unit of analysis work: the application of
@@ -192,6 +522,7 @@ type action struct {
 	result      interface{}
 	diagnostics []analysis.Diagnostic
 	err         error
+	wall        time.Duration
 }
 
 func (act *action) String() string {
@@ -260,7 +591,13 @@ func (act *action) execOnce() {
 	if act.pkg.illTyped && !pass.Analyzer.RunDespiteErrors {
 		err = fmt.Errorf("analysis skipped due to type-checking error: %v", act.pkg.typeCheckError)
 	} else {
-		act.result, err = pass.Analyzer.Run(pass)
+		// Label samples in CPU profiles with the analyzer that is running.
+		labels := pprof.Labels("analyzer", act.a.Name)
+		pprof.Do(context.Background(), labels, func(context.Context) {
+			start := time.Now()
+			act.result, err = pass.Analyzer.Run(pass)
+			act.wall = time.Since(start)
+		})
 		if err == nil {
 			if got, want := reflect.TypeOf(act.result), pass.Analyzer.ResultType; got != want {
 				err = fmt.Errorf(
@@ -300,6 +637,10 @@ func load(packagePath string, imp *importer, filenames []string) (*goPackage, er
 		pkg.illTyped, pkg.typeCheckError = true, err
 	}
 	pkg.types, pkg.typesInfo = types, info
+	// Packages loaded later with the same importer may import this one. This
+	// happens when the standalone driver analyzes several packages.
+	types.MarkComplete()
+	imp.packageCache[packagePath] = types
 
 	pkg.facts, err = facts.Decode(pkg.types, imp.readFacts)
 	if err != nil {
@@ -337,31 +678,60 @@ func (g *goPackage) String() string {
 	return g.types.Path()
 }
 
+// diagnosticEntry is a diagnostic together with the analyzer that reported it.
+type diagnosticEntry struct {
+	analysis.Diagnostic
+	*analysis.Analyzer
+	severity severity
+}
+
 // checkAnalysisResults checks the analysis diagnostics in the given actions
-// and returns a string containing all the diagnostics that should be printed
-// to the build log.
-func checkAnalysisResults(actions []*action, pkg *goPackage) string {
-	var diagnostics []analysis.Diagnostic
-	var errs []error
+// and returns two strings to be printed to the build log: one containing the
+// diagnostics that should fail the build, and one containing warnings.
+// The diagnostics themselves are returned, too, along with baseline entries
+// for all diagnostics, including those suppressed by the baseline. If any
+// analyzer failed, an error describing the failures is returned as well.
+//
+// When fixing is true, suggested fixes are being written to a patch, so
+// diagnostics with a suggested fix are reported as warnings. Diagnostics
+// without one still fail the build.
+func checkAnalysisResults(actions []*action, pkg *goPackage, fixing bool) (string, string, []diagnosticEntry, []baselineEntry, error) {
+	var diagnostics, unfiltered []diagnosticEntry
+	var errs []string
+	ran := make(map[string]bool)
 	for _, act := range actions {
 		if act.err != nil {
 			// Analyzer failed.
-			errs = append(errs, fmt.Errorf("analyzer %q failed: %v", act.a.Name, act.err))
+			errs = append(errs, fmt.Sprintf("analyzer %q failed: %v", act.a.Name, act.err))
 			continue
 		}
+		ran[act.a.Name] = true
 		if len(act.diagnostics) == 0 {
 			continue
 		}
+		for _, d := range act.diagnostics {
+			unfiltered = append(unfiltered, diagnosticEntry{Diagnostic: d, Analyzer: act.a})
+		}
 		config, ok := configs[act.a.Name]
 		if !ok {
 			// If the analyzer is not explicitly configured, it emits diagnostics for
-			// all files.
-			diagnostics = append(diagnostics, act.diagnostics...)
+			// all files, and they are errors.
+			for _, d := range act.diagnostics {
+				diagnostics = append(diagnostics, diagnosticEntry{Diagnostic: d, Analyzer: act.a})
+			}
+			continue
+		}
+		if config.severity == severityOff {
 			continue
 		}
 		// Discard diagnostics based on the analyzer configuration.
 		for _, d := range act.diagnostics {
-			filename := pkg.fset.File(d.Pos).Name()
+			// Diagnostics without a position, like those vet reports in files
+			// nogo didn't load, don't match any file pattern.
+			filename := ""
+			if f := pkg.fset.File(d.Pos); f != nil {
+				filename = f.Name()
+			}
 			include := true
 			if len(config.onlyFiles) > 0 {
 				// This analyzer emits diagnostics for only a set of files.
@@ -382,30 +752,37 @@ func checkAnalysisResults(actions []*action, pkg *goPackage) string {
 				}
 			}
 			if include {
-				diagnostics = append(diagnostics, d)
+				diagnostics = append(diagnostics, diagnosticEntry{Diagnostic: d, Analyzer: act.a, severity: config.severity})
 			}
 		}
 	}
-	if len(diagnostics) == 0 && len(errs) == 0 {
-		return ""
+	diagnostics = applyIgnoreDirectives(pkg, ran, unfiltered, diagnostics)
+	diagnostics, baselineEntries := applyBaseline(pkg, diagnostics)
+	var analyzerErr error
+	if len(errs) > 0 {
+		analyzerErr = errors.New(strings.Join(errs, "\n"))
+	}
+	if len(diagnostics) == 0 {
+		return "", "", nil, baselineEntries, analyzerErr
 	}
 
 	sort.Slice(diagnostics, func(i, j int) bool {
 		return diagnostics[i].Pos < diagnostics[j].Pos
 	})
-	errMsg := &bytes.Buffer{}
-	sep := ""
-	for _, err := range errs {
-		errMsg.WriteString(sep)
-		sep = "\n"
-		errMsg.WriteString(err.Error())
-	}
+	errMsg, warnMsg := &bytes.Buffer{}, &bytes.Buffer{}
+	errSep, warnSep := "", ""
 	for _, d := range diagnostics {
-		errMsg.WriteString(sep)
-		sep = "\n"
+		if d.severity == severityWarning || fixing && len(d.SuggestedFixes) > 0 {
+			warnMsg.WriteString(warnSep)
+			warnSep = "\n"
+			fmt.Fprintf(warnMsg, "%s: %s", pkg.fset.Position(d.Pos), d.Message)
+			continue
+		}
+		errMsg.WriteString(errSep)
+		errSep = "\n"
 		fmt.Fprintf(errMsg, "%s: %s", pkg.fset.Position(d.Pos), d.Message)
 	}
-	return errMsg.String()
+	return errMsg.String(), warnMsg.String(), diagnostics, baselineEntries, analyzerErr
 }
 
 // config determines which source files an analyzer will emit diagnostics for.
@@ -420,6 +797,41 @@ type config struct {
 	// excludeFiles is a list of regular expressions that match files that an
 	// analyzer will not emit diagnostics for.
 	excludeFiles []*regexp.Regexp
+
+	// severity determines whether diagnostics emitted by an analyzer fail the
+	// build.
+	severity severity
+
+	// analyzerFlags maps the names of flags declared by an analyzer to the
+	// values they are set to.
+	analyzerFlags map[string]string
+}
+
+// severity determines how diagnostics emitted by an analyzer are reported.
+type severity int
+
+const (
+	// severityError diagnostics are printed and fail the build. This is
+	// the default.
+	severityError severity = iota
+
+	// severityWarning diagnostics are printed but do not fail the build.
+	severityWarning
+
+	// severityOff diagnostics are discarded. Analyzers with this severity are
+	// not run unless they are required by other analyzers.
+	severityOff
+)
+
+func (s severity) String() string {
+	switch s {
+	case severityWarning:
+		return "warning"
+	case severityOff:
+		return "off"
+	default:
+		return "error"
+	}
 }
 
 // importer is an implementation of go/types.Importer that imports type
@@ -430,15 +842,21 @@ type importer struct {
 	packageCache map[string]*types.Package // cache of previously imported packages
 	packageFile  map[string]string         // map package path to .a file with export data
 	stdImports   map[string]bool           // imports from the standard library
+	stdlibFacts  string                    // directory with facts for the standard library, if any
+	facts        map[string][]byte         // facts for packages analyzed in this process
+	factsFile    map[string]string         // map package path to file with facts computed by nogo
+	vetxFile     map[string]string         // map package path to file with facts computed by vet
 }
 
-func newImporter(importMap, packageFile map[string]string, stdImports map[string]bool) *importer {
+func newImporter(importMap, packageFile map[string]string, stdImports map[string]bool, stdlibFacts string) *importer {
 	return &importer{
 		fset:         token.NewFileSet(),
 		importMap:    importMap,
 		packageCache: make(map[string]*types.Package),
 		packageFile:  packageFile,
 		stdImports:   stdImports,
+		stdlibFacts:  stdlibFacts,
+		facts:        make(map[string][]byte),
 	}
 }
 
@@ -482,19 +900,38 @@ func (i *importer) Import(path string) (*types.Package, error) {
 }
 
 func (i *importer) readFacts(path string) ([]byte, error) {
+	if data, ok := i.facts[path]; ok {
+		return data, nil
+	}
 	if i.stdImports[path] {
-		// Standard library packages are built ahead of time and are not analyzed,
-		// so there's no opportunity to store facts. Analyzers are expected to
-		// hard code information about standard library definitions. For example,
+		// Standard library packages are built ahead of time. Unless nogo was
+		// configured with stdlib_facts, they are not analyzed, so there's no
+		// opportunity to store facts. Analyzers are expected to hard code
+		// information about standard library definitions. For example,
 		// "printf" should know fmt.Printf accepts a format string.
-		return nil, nil
+		if i.stdlibFacts == "" {
+			return nil, nil
+		}
+		// Facts are missing for packages that couldn't be analyzed, like those
+		// that use cgo.
+		data, err := ioutil.ReadFile(filepath.Join(i.stdlibFacts, filepath.FromSlash(path)+".x"))
+		if os.IsNotExist(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("could not read analysis facts for %q: %v", path, err)
+		}
+		return data, nil
 	}
-	archivePath, ok := i.packageFile[path]
-	if !ok {
+	if _, ok := i.packageFile[path]; !ok {
 		return nil, fmt.Errorf("could not read analysis facts for %q: unknown import", path)
 	}
-	exportPath := strings.TrimSuffix(archivePath, ".a") + ".x"
-	data, err := ioutil.ReadFile(exportPath)
+	factsPath, ok := i.factsFile[path]
+	if !ok {
+		// The dependency wasn't analyzed, for example, because it was built
+		// with go_tool_library, so there are no facts.
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(factsPath)
 	if err != nil {
 		return nil, fmt.Errorf("could not read analysis facts for %q: %v", path, err)
 	}
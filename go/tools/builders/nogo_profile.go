@@ -0,0 +1,83 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Records how much time each analyzer uses, so expensive analyzers can be
+// identified.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+)
+
+// packageProfile is the JSON document written for each package analyzed by
+// nogo when profiling is enabled.
+type packageProfile struct {
+	// Package is the package path (importmap) of the analyzed package.
+	Package string `json:"package"`
+
+	// LoadNs is the time spent parsing and type checking the package and
+	// reading facts, in nanoseconds.
+	LoadNs int64 `json:"load_ns"`
+
+	// VetNs is the time spent running vet, in nanoseconds. vet runs in a
+	// separate process concurrently with the analyzers.
+	VetNs int64 `json:"vet_ns,omitempty"`
+
+	// Analyzers has an entry for each analyzer that ran, sorted by name.
+	// This includes analyzers that only ran because others required them.
+	Analyzers []analyzerProfile `json:"analyzers"`
+}
+
+type analyzerProfile struct {
+	Analyzer string `json:"analyzer"`
+
+	// WallNs is the time spent in the analyzer's Run function, not including
+	// the analyzers it requires, in nanoseconds. Analyzers run concurrently,
+	// so this includes time spent waiting for a CPU. It is zero for vet
+	// checks.
+	WallNs int64 `json:"wall_ns"`
+
+	// Diagnostics is the number of diagnostics reported by the analyzer,
+	// before any are discarded according to the configuration.
+	Diagnostics int `json:"diagnostics"`
+}
+
+// addActions records statistics for the given actions.
+func (p *packageProfile) addActions(actions []*action) {
+	for _, act := range actions {
+		p.Analyzers = append(p.Analyzers, analyzerProfile{
+			Analyzer:    act.a.Name,
+			WallNs:      act.wall.Nanoseconds(),
+			Diagnostics: len(act.diagnostics),
+		})
+	}
+	sort.Slice(p.Analyzers, func(i, j int) bool {
+		return p.Analyzers[i].Analyzer < p.Analyzers[j].Analyzer
+	})
+}
+
+func writeProfile(path string, p *packageProfile) error {
+	if p.Analyzers == nil {
+		p.Analyzers = []analyzerProfile{}
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0666)
+}
@@ -0,0 +1,279 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Analyzes many packages in one process without compiling them, so editors
+// and other tools can run the same analyzers as the build without invoking
+// Bazel.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// standalonePackage is a package loaded from source by the standalone
+// driver.
+type standalonePackage struct {
+	path    string   // package path
+	files   []string // Go files, after build constraints are applied
+	imports []string // import paths, as written in source
+}
+
+// runStandalone analyzes the packages listed in a manifest or found in a
+// directory produced by go_path. Packages are type checked from source and
+// analyzed in dependency order, so type information and facts are passed
+// between them in memory. Diagnostics are printed for packages matching
+// patterns, or for all packages if there are no patterns. Other packages are
+// only analyzed to compute facts. vet is not run.
+//
+// The manifest is an importcfg file with an additional directive,
+// "packagedir path=dir", naming a package to analyze and the directory
+// containing its sources. Packages that aren't analyzed are imported from
+// export data, which is read from archives named by packagefile directives,
+// archives in the pkg directory of the go_path tree, or the standard library
+// of the Go installation. No facts are available for these packages, other
+// than those in stdlibFacts for the standard library.
+func runStandalone(manifest, gopath string, patterns []string, stdlibFacts string) error {
+	packageFile, importMap, packageDir := make(map[string]string), make(map[string]string), make(map[string]string)
+	if manifest != "" {
+		data, err := ioutil.ReadFile(manifest)
+		if err != nil {
+			return fmt.Errorf("-manifest: %v", err)
+		}
+		if packageFile, importMap, packageDir, err = parseImportCfg(manifest, data, true); err != nil {
+			return err
+		}
+	}
+	if gopath != "" {
+		if err := scanGoPath(gopath, packageFile, packageDir); err != nil {
+			return err
+		}
+	}
+
+	pkgs := make(map[string]*standalonePackage)
+	for path, dir := range packageDir {
+		bp, err := build.ImportDir(dir, 0)
+		if _, ok := err.(*build.NoGoError); ok {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("error reading package %s: %v", path, err)
+		}
+		if len(bp.CgoFiles) > 0 {
+			// cgo would need to run before the package could be type checked.
+			// It may still be imported from export data.
+			fmt.Fprintf(os.Stderr, "nogo: skipping %s: packages that use cgo can't be analyzed without building them\n", path)
+			continue
+		}
+		pkg := &standalonePackage{path: path, imports: bp.Imports}
+		for _, f := range bp.GoFiles {
+			pkg.files = append(pkg.files, filepath.Join(dir, f))
+		}
+		pkgs[path] = pkg
+	}
+
+	// Find export data for the standard library packages that are imported.
+	stdImports := make(map[string]bool)
+	for _, pkg := range pkgs {
+		for _, path := range pkg.imports {
+			if p, ok := importMap[path]; ok {
+				path = p
+			}
+			if pkgs[path] != nil || path == "unsafe" || path == "C" {
+				continue
+			}
+			bp, err := build.Import(path, "", build.FindOnly)
+			if err != nil || !bp.Goroot {
+				continue
+			}
+			stdImports[path] = true
+			if _, ok := packageFile[path]; !ok && bp.PkgObj != "" {
+				packageFile[path] = bp.PkgObj
+			}
+		}
+	}
+
+	ordered, err := sortStandalonePackages(pkgs, importMap)
+	if err != nil {
+		return err
+	}
+
+	imp := newImporter(importMap, packageFile, stdImports, stdlibFacts)
+	for path := range packageFile {
+		if pkgs[path] == nil && !stdImports[path] {
+			// Facts are only stored next to archives built by Bazel.
+			imp.facts[path] = nil
+		}
+	}
+	var errs []string
+	found := false
+	for _, pkg := range ordered {
+		report := matchPackage(patterns, pkg.path)
+		pkgAnalyzers := analyzers
+		if !report {
+			pkgAnalyzers = factAnalyzers(analyzers)
+		}
+		diagnostics, warnings, _, _, facts, err := checkPackage(pkgAnalyzers, pkg.path, imp, pkg.files, nil, "", "", false, nil)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", pkg.path, err))
+			continue
+		}
+		imp.facts[pkg.path] = facts
+		if !report {
+			continue
+		}
+		if warnings != "" {
+			fmt.Println(warnings)
+		}
+		if diagnostics != "" {
+			fmt.Println(diagnostics)
+			found = true
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	if found {
+		return errors.New("errors found by nogo during code analysis")
+	}
+	return nil
+}
+
+// scanGoPath adds the packages in a directory produced by go_path to
+// packageDir. Archives in the pkg directory, which is present when go_path
+// is used with include_pkg, are added to packageFile.
+func scanGoPath(gopath string, packageFile, packageDir map[string]string) error {
+	srcDir := filepath.Join(gopath, "src")
+	err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != srcDir && (info.Name() == "testdata" || strings.HasPrefix(info.Name(), ".") || strings.HasPrefix(info.Name(), "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		dir := filepath.Dir(path)
+		rel, err := filepath.Rel(srcDir, dir)
+		if err != nil {
+			return err
+		}
+		packageDir[filepath.ToSlash(rel)] = dir
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error reading -gopath: %v", err)
+	}
+
+	pkgDir := filepath.Join(gopath, "pkg", build.Default.GOOS+"_"+build.Default.GOARCH)
+	if _, err := os.Stat(pkgDir); os.IsNotExist(err) {
+		return nil
+	}
+	err = filepath.Walk(pkgDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".a") {
+			return err
+		}
+		rel, err := filepath.Rel(pkgDir, strings.TrimSuffix(path, ".a"))
+		if err != nil {
+			return err
+		}
+		if _, ok := packageFile[filepath.ToSlash(rel)]; !ok {
+			packageFile[filepath.ToSlash(rel)] = path
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error reading -gopath: %v", err)
+	}
+	return nil
+}
+
+// sortStandalonePackages returns pkgs sorted so that each package comes after
+// the packages it imports. Packages are otherwise sorted by path, so the
+// output is deterministic.
+func sortStandalonePackages(pkgs map[string]*standalonePackage, importMap map[string]string) ([]*standalonePackage, error) {
+	paths := make([]string, 0, len(pkgs))
+	for path := range pkgs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var ordered []*standalonePackage
+	var visit func(path string, stack []string) error
+	visit = func(path string, stack []string) error {
+		switch state[path] {
+		case visiting:
+			return fmt.Errorf("import cycle: %s", strings.Join(append(stack, path), " -> "))
+		case visited:
+			return nil
+		}
+		state[path] = visiting
+		pkg := pkgs[path]
+		for _, imp := range pkg.imports {
+			if p, ok := importMap[imp]; ok {
+				imp = p
+			}
+			if pkgs[imp] == nil {
+				continue
+			}
+			if err := visit(imp, append(stack, path)); err != nil {
+				return err
+			}
+		}
+		state[path] = visited
+		ordered = append(ordered, pkg)
+		return nil
+	}
+	for _, path := range paths {
+		if err := visit(path, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// matchPackage returns whether path matches one of patterns. A pattern
+// matches a package path exactly, unless it ends with "/...", in which case
+// it also matches packages below it. The pattern "..." matches everything.
+// If there are no patterns, every package matches.
+func matchPackage(patterns []string, path string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if pattern == "..." || pattern == path {
+			return true
+		}
+		if prefix := strings.TrimSuffix(pattern, "/..."); prefix != pattern && (path == prefix || strings.HasPrefix(path, prefix+"/")) {
+			return true
+		}
+	}
+	return false
+}
@@ -15,99 +15,219 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"go/token"
 	"io/ioutil"
 	"os"
 	"os/exec"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+
+	"golang.org/x/tools/go/analysis"
 )
 
-// vet runs the 'go vet tool' command with the given vet configuration file and
-// returns the emitted findings. It returns an error only if vet emits no
-// findings and at least one error message.
-func runVet(vetTool, vcfg string) (string, error) {
-	args := append(vetFlags, vcfg)
+// defaultVetChecks are the vet checks run when vet is enabled and no checks
+// are listed in the configuration. Checks are named after the analyzers vet
+// runs (see "go tool vet help"), which is how vet reports their diagnostics.
+var defaultVetChecks = []string{
+	// NOTE: Keep in sync with github.com/golang/go/src/cmd/go/internal/test/test.go
+	"atomic",
+	"bools",
+	"buildtag",
+	"nilfunc",
+	"printf",
+}
+
+// enabledVetChecks returns the names of the vet checks that should be run.
+// It returns nil if vet is disabled.
+func enabledVetChecks() []string {
+	if !vetEnabled {
+		return nil
+	}
+	checks := vetChecks
+	if len(checks) == 0 {
+		checks = defaultVetChecks
+	}
+	var enabled []string
+	for _, check := range checks {
+		if configs[check].severity != severityOff {
+			enabled = append(enabled, check)
+		}
+	}
+	return enabled
+}
+
+// runVet runs the 'go tool vet' command on pkg with the given checks enabled.
+// It returns an action for each check holding the diagnostics it reported, so
+// they can be handled like diagnostics from other analyzers. If vet reports
+// diagnostics under another name (for example, because a check was enabled
+// with a legacy flag name), an action is returned for that name, too. Facts
+// computed by vet are written to vetxOut.
+func runVet(vetTool string, checks []string, pkg *goPackage, packagePath string, packageFile, importMap, vetxFile map[string]string, stdImports map[string]bool, files []string, vetxOut string) ([]*action, error) {
+	vcfg, err := buildVetcfgFile(packagePath, packageFile, importMap, vetxFile, stdImports, files, vetxOut)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(vcfg)
+
+	args := []string{"-json"}
+	for _, check := range checks {
+		args = append(args, "-"+check)
+		// vet prefixes the flags of each analyzer with the analyzer's name.
+		flags := configs[check].analyzerFlags
+		names := make([]string, 0, len(flags))
+		for name := range flags {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			args = append(args, fmt.Sprintf("-%s.%s=%s", check, name, flags[name]))
+		}
+	}
+	args = append(args, vcfg)
 	cmd := exec.Command(vetTool, args...)
-	out, err := cmd.CombinedOutput()
-	// Note: 'go tool vet' emits a non-zero return code both when vet encounters
-	// an internal error and when vet finds legitimate issues.
-	if err == nil {
-		return "", nil
-	}
-	vetFindings, vetErrors := []string{}, []string{}
-	errMsgs := splitOutput(string(out))
-	for _, m := range errMsgs {
-		if !vetErrorMsgPattern.MatchString(m) {
-			vetErrors = append(vetErrors, m)
-			continue
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	// Note: vet only exits with a non-zero status when it encounters an error.
+	// Findings are printed in JSON format and don't affect the status.
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, stderr.Bytes())
+	}
+
+	// vet prints a JSON object mapping package IDs to analyzer names to either
+	// a list of diagnostics or an error.
+	var tree map[string]map[string]json.RawMessage
+	if stdout.Len() > 0 {
+		if err := json.Unmarshal(stdout.Bytes(), &tree); err != nil {
+			return nil, fmt.Errorf("error parsing vet output: %v", err)
+		}
+	}
+	var actions []*action
+	actionByName := make(map[string]*action)
+	actionFor := func(name string) *action {
+		act, ok := actionByName[name]
+		if !ok {
+			act = &action{
+				a:   &analysis.Analyzer{Name: name, Doc: "the " + name + " check run by vet"},
+				pkg: pkg,
+			}
+			actionByName[name] = act
+			actions = append(actions, act)
 		}
-		vetFindings = append(vetFindings, m)
+		return act
 	}
-	if len(vetFindings) == 0 && len(vetErrors) != 0 {
-		return "", errors.New(strings.Join(vetErrors, "\n"))
+	for _, check := range checks {
+		actionFor(check)
 	}
-	return strings.Join(vetFindings, "\n"), nil
+	for _, results := range tree {
+		names := make([]string, 0, len(results))
+		for name := range results {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			data := results[name]
+			act := actionFor(name)
+			var failure struct {
+				Error string `json:"error"`
+			}
+			if json.Unmarshal(data, &failure) == nil && failure.Error != "" {
+				act.err = fmt.Errorf("%s", failure.Error)
+				continue
+			}
+			var diagnostics []vetDiagnostic
+			if err := json.Unmarshal(data, &diagnostics); err != nil {
+				return nil, fmt.Errorf("error parsing vet output for %s: %v", name, err)
+			}
+			for _, d := range diagnostics {
+				act.diagnostics = append(act.diagnostics, analysis.Diagnostic{
+					Pos:      vetPos(pkg, d.Posn),
+					Category: d.Category,
+					Message:  d.Message,
+				})
+			}
+		}
+	}
+	return actions, nil
 }
 
-var vetFlags = []string{
-	// NOTE: Keep in sync with github.com/golang/go/src/cmd/go/internal/test/test.go
-	"-atomic",
-	"-bool",
-	"-buildtags",
-	"-nilfunc",
-	"-printf",
+// vetDiagnostic is a diagnostic printed by vet in JSON format.
+type vetDiagnostic struct {
+	Category string `json:"category"`
+	Posn     string `json:"posn"`
+	Message  string `json:"message"`
 }
 
-// vetErrorMsgPattern matches an error message emitted by vet.
-//
-// This regexp should be strict enough to exclude internal errors (prefixed with
-// "vet") and type-check errors (which additionally include a column number).
-//
-// NOTE: this might break if the formating of vet error messages changes.
-var vetErrorMsgPattern = regexp.MustCompile(`^([^:]+?):([0-9]+): (.*)`)
-
-// splitOutput was adapted from go/test/run.go.
-func splitOutput(out string) []string {
-	// gc error messages continue onto additional lines with leading tabs.
-	// Split the output at the beginning of each line that doesn't begin with a tab.
-	// <autogenerated> lines are impossible to match so those are filtered out.
-	var res []string
-	for _, line := range strings.Split(out, "\n") {
-		line = strings.TrimSuffix(line, "\r") // normalize Windows output
-		if strings.HasPrefix(line, "\t") {
-			res[len(res)-1] += "\n" + line
-		} else if strings.HasPrefix(line, "go tool") || strings.HasPrefix(line, "#") {
+// vetPos converts a position printed by vet, in the form "file:line:column"
+// or "file:line", into a position in the file set of pkg. It returns
+// token.NoPos if the file is not part of pkg, for example, when vet reports
+// a position in the original source of a cgo file, named by a //line
+// comment.
+func vetPos(pkg *goPackage, posn string) token.Pos {
+	filename, line, column := posn, 0, 0
+	if i := strings.LastIndex(filename, ":"); i >= 0 {
+		if n, err := strconv.Atoi(filename[i+1:]); err == nil {
+			filename, line = filename[:i], n
+		}
+	}
+	if i := strings.LastIndex(filename, ":"); i >= 0 {
+		if n, err := strconv.Atoi(filename[i+1:]); err == nil {
+			filename, line, column = filename[:i], n, line
+		}
+	}
+	for _, f := range pkg.syntax {
+		tf := pkg.fset.File(f.Pos())
+		if tf.Name() != filename || line < 1 || line > tf.LineCount() {
 			continue
-		} else if strings.TrimSpace(line) != "" {
-			res = append(res, line)
 		}
+		// token.File.LineStart requires go1.12, so search for the first offset
+		// on the line. Positions aren't adjusted by //line comments here, since
+		// vet's position names this file.
+		offset := sort.Search(tf.Size()+1, func(o int) bool {
+			return tf.PositionFor(tf.Pos(o), false).Line >= line
+		})
+		if column > 1 && offset+column-1 <= tf.Size() {
+			offset += column - 1
+		}
+		return tf.Pos(offset)
 	}
-	return res
+	return token.NoPos
 }
 
 // buildVetcfgFile creates a vet.cfg file and returns its file path. It is the
 // caller's responsibility to remove this file when it is no longer needed.
-func buildVetcfgFile(packageFile, importMap map[string]string, stdImports, files []string) (vcfgPath_ string, err error) {
-	for path := range packageFile {
-		if _, ok := importMap[path]; !ok {
-			// vet expects every import path to be in the import map, even if the
-			// mapping is redundant.
-			importMap[path] = path
-		}
-	}
+func buildVetcfgFile(packagePath string, packageFile, importMap, vetxFile map[string]string, stdImports map[string]bool, files []string, vetxOut string) (vcfgPath_ string, err error) {
 	vcfg := &vetConfig{
 		Compiler:                  "gc", // gccgo is currently not supported
+		ImportPath:                packagePath,
 		GoFiles:                   files,
-		ImportMap:                 importMap,
+		ImportMap:                 make(map[string]string),
 		PackageFile:               packageFile,
 		Standard:                  make(map[string]bool),
+		PackageVetx:               make(map[string]string),
+		VetxOutput:                vetxOut,
 		SucceedOnTypecheckFailure: false,
 	}
-	for _, imp := range stdImports {
-		vcfg.Standard[imp] = true
+	for path, pkgPath := range importMap {
+		vcfg.ImportMap[path] = pkgPath
+	}
+	for path := range packageFile {
+		if _, ok := vcfg.ImportMap[path]; !ok {
+			// vet expects every import path to be in the import map, even if the
+			// mapping is redundant.
+			vcfg.ImportMap[path] = path
+		}
+		if stdImports[path] {
+			vcfg.Standard[path] = true
+			continue
+		}
+		// Facts computed by vet are missing if the dependency was not analyzed.
+		if vetx, ok := vetxFile[path]; ok {
+			vcfg.PackageVetx[path] = vetx
+		}
 	}
 
 	// GRIPE: vet checks whether its first positional argument has the suffix
@@ -42,7 +42,7 @@ func run(args []string) error {
 	if err != nil {
 		return err
 	}
-	flags := flag.NewFlagSet("GoPack", flag.ExitOnError)
+	flags := flag.NewFlagSet("GoPack", flag.ContinueOnError)
 	goenv := envFlags(flags)
 	inArchive := flags.String("in", "", "Path to input archive")
 	outArchive := flags.String("out", "", "Path to output archive")
@@ -82,7 +82,7 @@ func run(args []string) error {
 func main() {
 	log.SetFlags(0)
 	log.SetPrefix("GoPack: ")
-	if err := run(os.Args[1:]); err != nil {
+	if err := runBuilder(os.Args[1:], run); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -13,6 +13,7 @@
 // limitations under the License.
 
 // stdlib builds the standard library in the appropriate mode into a new goroot.
+// With -nogo, it instead computes nogo facts for the standard library.
 package main
 
 import (
@@ -38,12 +39,18 @@ func run(args []string) error {
 	race := flags.Bool("race", false, "Build in race mode")
 	shared := flags.Bool("shared", false, "Build in shared mode")
 	dynlink := flags.Bool("dynlink", false, "Build in dynlink mode")
+	nogo := flags.String("nogo", "", "Path to a nogo binary used to compute facts instead of building")
+	factsOut := flags.String("facts_out", "", "Path to the directory where nogo facts should be written")
+	archiveRoot := flags.String("archive_root", "", "Path to the go root containing the compiled standard library")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
 	if err := goenv.checkFlags(); err != nil {
 		return err
 	}
+	if *nogo != "" {
+		return buildStdlibFacts(goenv, *nogo, *archiveRoot, *factsOut)
+	}
 	goroot := os.Getenv("GOROOT")
 	if goroot == "" {
 		return fmt.Errorf("GOROOT not set")
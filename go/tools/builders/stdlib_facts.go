@@ -0,0 +1,209 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// stdPackage is the subset of the output of "go list -json" needed to
+// analyze a standard library package.
+type stdPackage struct {
+	ImportPath string
+	Dir        string
+	GoFiles    []string
+	CgoFiles   []string
+	Imports    []string
+	ImportMap  map[string]string
+}
+
+// buildStdlibFacts runs nogo in facts-only mode on each package in the
+// standard library and writes the facts to outDir, in files named after the
+// package paths with the extension ".x". Sources are read from GOROOT, and
+// export data is read from the compiled standard library in archiveRoot.
+//
+// Packages that use cgo are skipped, since nogo can't analyze them without
+// running cgo first. nogo treats missing facts as empty.
+func buildStdlibFacts(goenv *env, nogo, archiveRoot, outDir string) error {
+	goroot := os.Getenv("GOROOT")
+	if goroot == "" {
+		return fmt.Errorf("GOROOT not set")
+	}
+	os.Setenv("GOROOT", abs(goroot))
+
+	// "go list" requires a cache directory, even though nothing is built.
+	cachePath, err := ioutil.TempDir("", "gocache")
+	if err != nil {
+		return err
+	}
+	os.Setenv("GOCACHE", cachePath)
+	defer os.RemoveAll(cachePath)
+
+	pkgs, err := listStdPackages(goenv)
+	if err != nil {
+		return err
+	}
+
+	importcfg, err := buildStdlibImportcfgFile(goenv, pkgs, archiveRoot)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(importcfg)
+
+	// Every package is in the standard library, so nogo reads facts for all
+	// imports from outDir.
+	outDir = abs(outDir)
+	baseArgs := []string{"-facts_only", "-importcfg", importcfg, "-stdlib_facts", outDir}
+	for _, pkg := range pkgs {
+		baseArgs = append(baseArgs, "-stdimport", pkg.ImportPath)
+	}
+
+	// Analyze packages concurrently. Each package waits for the packages it
+	// imports, since nogo reads their facts.
+	done := make(map[string]chan struct{})
+	for _, pkg := range pkgs {
+		done[pkg.ImportPath] = make(chan struct{})
+	}
+	sem := make(chan struct{}, runtime.NumCPU())
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []string
+	for _, pkg := range pkgs {
+		wg.Add(1)
+		go func(pkg *stdPackage) {
+			defer wg.Done()
+			defer close(done[pkg.ImportPath])
+			for _, imp := range pkg.Imports {
+				if ch, ok := done[imp]; ok {
+					<-ch
+				}
+			}
+			if pkg.ImportPath == "unsafe" || len(pkg.GoFiles) == 0 || len(pkg.CgoFiles) > 0 {
+				return
+			}
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if err := runNogoFacts(nogo, baseArgs, pkg, outDir); err != nil {
+				mu.Lock()
+				errs = append(errs, err.Error())
+				mu.Unlock()
+			}
+		}(pkg)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("error computing facts for the standard library:\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// listStdPackages lists the packages in the standard library and the packages
+// they depend on, in dependency order, with "go list -deps". -deps was added
+// in Go 1.11, and so was the ImportMap field used to resolve vendored
+// imports, so older SDKs are rejected with an error.
+func listStdPackages(goenv *env) ([]*stdPackage, error) {
+	// Builders are compiled with the SDK they run, so this is the SDK's version.
+	if minor, ok := goMinorVersion(); ok && minor < 11 {
+		return nil, fmt.Errorf("computing nogo facts for the standard library requires Go 1.11 or newer, but the Go SDK is %s; set stdlib_facts = False on the nogo target or use a newer SDK", runtime.Version())
+	}
+	listArgs := goenv.goCmd("list", "-deps", "-json")
+	if len(build.Default.BuildTags) > 0 {
+		listArgs = append(listArgs, "-tags", strings.Join(build.Default.BuildTags, " "))
+	}
+	listArgs = append(listArgs, "std")
+	listOut := &bytes.Buffer{}
+	if err := goenv.runCommandToFile(listOut, listArgs); err != nil {
+		return nil, err
+	}
+	var pkgs []*stdPackage
+	for dec := json.NewDecoder(listOut); dec.More(); {
+		pkg := &stdPackage{}
+		if err := dec.Decode(pkg); err != nil {
+			return nil, fmt.Errorf("error parsing go list output: %v", err)
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs, nil
+}
+
+// buildStdlibImportcfgFile writes an importcfg file mapping each package in
+// pkgs to its archive and returns the file's path. It is the caller's
+// responsibility to remove the file.
+func buildStdlibImportcfgFile(goenv *env, pkgs []*stdPackage, archiveRoot string) (string, error) {
+	pkgDir := filepath.Join(abs(archiveRoot), "pkg", goenv.installSuffix)
+	buf := &bytes.Buffer{}
+	importMap := make(map[string]string)
+	for _, pkg := range pkgs {
+		fmt.Fprintf(buf, "packagefile %s=%s\n", pkg.ImportPath, filepath.Join(pkgDir, filepath.FromSlash(pkg.ImportPath)+".a"))
+		for path, pkgPath := range pkg.ImportMap {
+			importMap[path] = pkgPath
+		}
+	}
+	paths := make([]string, 0, len(importMap))
+	for path := range importMap {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintf(buf, "importmap %s=%s\n", path, importMap[path])
+	}
+
+	f, err := ioutil.TempFile("", "importcfg")
+	if err != nil {
+		return "", err
+	}
+	filename := f.Name()
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		os.Remove(filename)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(filename)
+		return "", err
+	}
+	return filename, nil
+}
+
+// runNogoFacts runs nogo on pkg and writes its facts to outDir.
+func runNogoFacts(nogo string, baseArgs []string, pkg *stdPackage, outDir string) error {
+	xPath := filepath.Join(outDir, filepath.FromSlash(pkg.ImportPath)+".x")
+	if err := os.MkdirAll(filepath.Dir(xPath), 0777); err != nil {
+		return err
+	}
+	args := append([]string{}, baseArgs...)
+	args = append(args, "-p", pkg.ImportPath, "-x", xPath)
+	for _, f := range pkg.GoFiles {
+		args = append(args, filepath.Join(pkg.Dir, f))
+	}
+	cmd := exec.Command(nogo, args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v\n%s", pkg.ImportPath, err, out)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestListStdPackages(t *testing.T) {
+	// The test runs "go list" from the SDK it was built with.
+	sdk := runtime.GOROOT()
+	goExe := filepath.Join(sdk, "bin", "go")
+	if runtime.GOOS == "windows" {
+		goExe += ".exe"
+	}
+	if _, err := os.Stat(goExe); err != nil {
+		t.Skipf("Go SDK not available: %v", err)
+	}
+	if minor, ok := goMinorVersion(); ok && minor < 11 {
+		if _, err := listStdPackages(&env{sdk: sdk}); err == nil {
+			t.Errorf("unexpected success listing packages with %s", runtime.Version())
+		}
+		return
+	}
+	cacheDir, err := ioutil.TempDir("", "TestListStdPackages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+	defer os.Setenv("GOCACHE", os.Getenv("GOCACHE"))
+	os.Setenv("GOCACHE", cacheDir)
+
+	pkgs, err := listStdPackages(&env{sdk: sdk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := make(map[string]int)
+	for i, pkg := range pkgs {
+		index[pkg.ImportPath] = i
+	}
+	for _, path := range []string{"fmt", "runtime", "unsafe"} {
+		if _, ok := index[path]; !ok {
+			t.Errorf("package %q was not listed", path)
+		}
+	}
+	// Facts are computed for dependencies first, so each package's imports
+	// must come before it.
+	for i, pkg := range pkgs {
+		if pkg.Dir == "" {
+			t.Errorf("package %q has no directory", pkg.ImportPath)
+		}
+		for _, imp := range pkg.Imports {
+			if imp == "C" {
+				continue
+			}
+			if j, ok := index[imp]; !ok {
+				t.Errorf("package %q imports %q, which was not listed", pkg.ImportPath, imp)
+			} else if j >= i {
+				t.Errorf("package %q is listed before its import %q", pkg.ImportPath, imp)
+			}
+		}
+	}
+}
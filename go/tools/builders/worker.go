@@ -0,0 +1,349 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Support for Bazel's persistent worker protocol. Builders that support it
+// call runBuilder from main. When Bazel starts a builder with
+// --persistent_worker, the builder reads WorkRequests from stdin and writes
+// WorkResponses to stdout, running one action per request, until stdin is
+// closed. This saves the cost of starting a process for each action.
+//
+// See https://docs.bazel.build/versions/master/persistent-workers.html.
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+// runBuilder runs a builder's run function with args. If args contain
+// --persistent_worker, runBuilder processes work requests from stdin instead.
+// The protocol is protobuf unless --worker_protocol=json is also given.
+//
+// Arguments are passed to persistent workers in params files named by
+// arguments that start with "@". These are expanded before calling run when
+// the builder is not running as a worker.
+func runBuilder(args []string, run func([]string) error) error {
+	persistent := false
+	protocol := "proto"
+	var rest []string
+	for _, arg := range args {
+		switch {
+		case arg == "--persistent_worker":
+			persistent = true
+		case strings.HasPrefix(arg, "--worker_protocol="):
+			protocol = arg[len("--worker_protocol="):]
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	if !persistent {
+		expanded, err := expandFlagFiles(rest)
+		if err != nil {
+			return err
+		}
+		return run(expanded)
+	}
+
+	var codec workCodec
+	switch protocol {
+	case "proto":
+		codec = &protoWorkCodec{r: bufio.NewReader(os.Stdin), w: os.Stdout}
+	case "json":
+		codec = &jsonWorkCodec{dec: json.NewDecoder(os.Stdin), enc: json.NewEncoder(os.Stdout)}
+	default:
+		return fmt.Errorf("unknown worker protocol %q", protocol)
+	}
+	return runWorker(codec, run)
+}
+
+// expandFlagFiles replaces each argument that starts with "@" with the lines
+// of the file it names.
+func expandFlagFiles(args []string) ([]string, error) {
+	var expanded []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "@") {
+			expanded = append(expanded, arg)
+			continue
+		}
+		content, err := ioutil.ReadFile(arg[1:])
+		if err != nil {
+			return nil, err
+		}
+		lines := strings.Split(string(content), "\n")
+		if len(lines) > 0 && lines[len(lines)-1] == "" {
+			// Ignore final empty line.
+			lines = lines[:len(lines)-1]
+		}
+		expanded = append(expanded, lines...)
+	}
+	return expanded, nil
+}
+
+// workRequest is a request from Bazel to run an action. Only the fields
+// builders need are decoded.
+type workRequest struct {
+	Arguments []string `json:"arguments"`
+	RequestID int32    `json:"requestId"`
+}
+
+// workResponse is sent to Bazel when an action is complete. Output is shown
+// to the user if the action fails.
+type workResponse struct {
+	ExitCode  int32  `json:"exitCode"`
+	Output    string `json:"output"`
+	RequestID int32  `json:"requestId"`
+}
+
+type workCodec interface {
+	// readRequest reads the next request. It returns io.EOF when there
+	// are no more requests.
+	readRequest() (*workRequest, error)
+	writeResponse(*workResponse) error
+}
+
+// runWorker runs an action for each request read from codec, one at a time.
+//
+// Builders write to stdout and stderr, change environment variables, and add
+// build tags to build.Default, so each action runs with stdout, stderr and
+// the log package redirected to a temporary file, which becomes the
+// response's output, and the environment and build.Default are restored
+// afterward.
+func runWorker(codec workCodec, run func([]string) error) error {
+	origEnv := os.Environ()
+	for {
+		req, err := codec.readRequest()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("error reading work request: %v", err)
+		}
+		resp, err := runWorkRequest(req, run)
+		if err != nil {
+			return err
+		}
+		resetEnv(origEnv)
+		if err := codec.writeResponse(resp); err != nil {
+			return fmt.Errorf("error writing work response: %v", err)
+		}
+	}
+}
+
+// runWorkRequest runs an action and returns a response containing its output.
+// It only returns an error if the output can't be collected.
+func runWorkRequest(req *workRequest, run func([]string) error) (*workResponse, error) {
+	outFile, err := ioutil.TempFile("", "worker-output")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(outFile.Name())
+	defer outFile.Close()
+
+	origContext := build.Default
+	origContext.BuildTags = append([]string(nil), build.Default.BuildTags...)
+	defer func() { build.Default = origContext }()
+
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = outFile, outFile
+	log.SetOutput(outFile)
+	exitCode := int32(0)
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("panic: %v", r)
+				exitCode = 1
+			}
+		}()
+		if err := run(req.Arguments); err != nil {
+			log.Print(err)
+			exitCode = 1
+		}
+	}()
+	os.Stdout, os.Stderr = stdout, stderr
+	log.SetOutput(stderr)
+
+	if _, err := outFile.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	output, err := ioutil.ReadAll(outFile)
+	if err != nil {
+		return nil, err
+	}
+	return &workResponse{
+		ExitCode:  exitCode,
+		Output:    string(output),
+		RequestID: req.RequestID,
+	}, nil
+}
+
+// resetEnv replaces the environment with env, a list of "key=value" strings.
+func resetEnv(env []string) {
+	os.Clearenv()
+	for _, kv := range env {
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			os.Setenv(kv[:i], kv[i+1:])
+		}
+	}
+}
+
+// jsonWorkCodec implements the JSON worker protocol. Requests and responses
+// are JSON objects, separated by newlines.
+type jsonWorkCodec struct {
+	dec *json.Decoder
+	enc *json.Encoder
+}
+
+func (c *jsonWorkCodec) readRequest() (*workRequest, error) {
+	req := &workRequest{}
+	if err := c.dec.Decode(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (c *jsonWorkCodec) writeResponse(resp *workResponse) error {
+	return c.enc.Encode(resp)
+}
+
+// protoWorkCodec implements the protobuf worker protocol. Requests and
+// responses are WorkRequest and WorkResponse messages from Bazel's
+// worker_protocol.proto, each preceded by its length as a varint. Messages
+// are encoded by hand, since builders can't depend on a protobuf library.
+type protoWorkCodec struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+// Field numbers in worker_protocol.proto.
+const (
+	workRequestArgumentsField = 1
+	workRequestRequestIDField = 3
+
+	workResponseExitCodeField  = 1
+	workResponseOutputField    = 2
+	workResponseRequestIDField = 3
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func (c *protoWorkCodec) readRequest() (*workRequest, error) {
+	size, err := binary.ReadUvarint(c.r)
+	if err != nil {
+		// io.EOF is returned as is, when there's nothing left to read.
+		return nil, err
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(c.r, msg); err != nil {
+		return nil, err
+	}
+	return decodeWorkRequest(msg)
+}
+
+func (c *protoWorkCodec) writeResponse(resp *workResponse) error {
+	msg := encodeWorkResponse(resp)
+	buf := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(msg))
+	buf = append(buf[:binary.PutUvarint(buf, uint64(len(msg)))], msg...)
+	_, err := c.w.Write(buf)
+	return err
+}
+
+var errBadProto = errors.New("malformed protobuf message")
+
+func decodeWorkRequest(msg []byte) (*workRequest, error) {
+	req := &workRequest{}
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return nil, errBadProto
+		}
+		msg = msg[n:]
+		field, wire := key>>3, key&7
+		switch wire {
+		case wireVarint:
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return nil, errBadProto
+			}
+			msg = msg[n:]
+			if field == workRequestRequestIDField {
+				req.RequestID = int32(v)
+			}
+		case wireBytes:
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < size {
+				return nil, errBadProto
+			}
+			b := msg[n : n+int(size)]
+			msg = msg[n+int(size):]
+			if field == workRequestArgumentsField {
+				req.Arguments = append(req.Arguments, string(b))
+			}
+		case wireFixed64:
+			if len(msg) < 8 {
+				return nil, errBadProto
+			}
+			msg = msg[8:]
+		case wireFixed32:
+			if len(msg) < 4 {
+				return nil, errBadProto
+			}
+			msg = msg[4:]
+		default:
+			return nil, errBadProto
+		}
+	}
+	return req, nil
+}
+
+func encodeWorkResponse(resp *workResponse) []byte {
+	var msg []byte
+	if resp.ExitCode != 0 {
+		msg = appendProtoVarint(msg, workResponseExitCodeField, uint64(int64(resp.ExitCode)))
+	}
+	if resp.Output != "" {
+		msg = appendProtoBytes(msg, workResponseOutputField, []byte(resp.Output))
+	}
+	if resp.RequestID != 0 {
+		msg = appendProtoVarint(msg, workResponseRequestIDField, uint64(int64(resp.RequestID)))
+	}
+	return msg
+}
+
+func appendProtoVarint(msg []byte, field int, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	msg = append(msg, buf[:binary.PutUvarint(buf[:], uint64(field)<<3|wireVarint)]...)
+	return append(msg, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendProtoBytes(msg []byte, field int, b []byte) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	msg = append(msg, buf[:binary.PutUvarint(buf[:], uint64(field)<<3|wireBytes)]...)
+	msg = append(msg, buf[:binary.PutUvarint(buf[:], uint64(len(b)))]...)
+	return append(msg, b...)
+}
@@ -0,0 +1,325 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// requestsFile contains work requests recorded from Bazel, in the JSON
+// protocol. Some have extra arguments that fakeBuilder responds to.
+const requestsFile = "testdata/worker_requests.json"
+
+const workerTestEnv = "WORKER_TEST_ENV"
+
+// fakeBuilder prints its arguments, like a builder printing diagnostics.
+// It fails with -fail, panics with -panic, and sets an environment variable
+// with -setenv.
+func fakeBuilder(args []string) error {
+	builderArgs, toolArgs := splitArgs(args)
+	if v, ok := os.LookupEnv(workerTestEnv); ok {
+		fmt.Printf("%s leaked: %s\n", workerTestEnv, v)
+	}
+	for _, arg := range builderArgs {
+		switch arg {
+		case "-fail":
+			return errors.New("failed")
+		case "-panic":
+			panic("oops")
+		case "-setenv":
+			os.Setenv(workerTestEnv, "1")
+		}
+	}
+	fmt.Printf("builder: %s\n", strings.Join(builderArgs, " "))
+	fmt.Fprintf(os.Stderr, "tool: %s\n", strings.Join(toolArgs, " "))
+	return nil
+}
+
+func readRecordedRequests(t *testing.T) []*workRequest {
+	data, err := ioutil.ReadFile(requestsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reqs []*workRequest
+	for dec := json.NewDecoder(bytes.NewReader(data)); dec.More(); {
+		req := &workRequest{}
+		if err := dec.Decode(req); err != nil {
+			t.Fatal(err)
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs
+}
+
+func checkResponses(t *testing.T, reqs []*workRequest, resps []*workResponse) {
+	if len(resps) != len(reqs) {
+		t.Fatalf("got %d responses; want %d", len(resps), len(reqs))
+	}
+	for i, resp := range resps {
+		req := reqs[i]
+		if resp.RequestID != req.RequestID {
+			t.Errorf("response %d: got request id %d; want %d", i, resp.RequestID, req.RequestID)
+		}
+		if strings.Contains(resp.Output, "leaked") {
+			t.Errorf("request %d: environment was not restored:\n%s", req.RequestID, resp.Output)
+		}
+		var wantCode int32
+		var wantOutput string
+		switch {
+		case contains(req.Arguments, "-fail"):
+			wantCode, wantOutput = 1, "failed"
+		case contains(req.Arguments, "-panic"):
+			wantCode, wantOutput = 1, "panic: oops"
+		default:
+			builderArgs, toolArgs := splitArgs(req.Arguments)
+			wantOutput = fmt.Sprintf("builder: %s\ntool: %s\n", strings.Join(builderArgs, " "), strings.Join(toolArgs, " "))
+		}
+		if resp.ExitCode != wantCode {
+			t.Errorf("request %d: got exit code %d; want %d", req.RequestID, resp.ExitCode, wantCode)
+		}
+		if !strings.Contains(resp.Output, wantOutput) {
+			t.Errorf("request %d: got output:\n%s\nwant output containing:\n%s", req.RequestID, resp.Output, wantOutput)
+		}
+	}
+}
+
+func contains(args []string, arg string) bool {
+	for _, a := range args {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWorkerJSON(t *testing.T) {
+	reqs := readRecordedRequests(t)
+	in, err := os.Open(requestsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	out := &bytes.Buffer{}
+	codec := &jsonWorkCodec{dec: json.NewDecoder(in), enc: json.NewEncoder(out)}
+	if err := runWorker(codec, fakeBuilder); err != nil {
+		t.Fatal(err)
+	}
+
+	var resps []*workResponse
+	for dec := json.NewDecoder(out); dec.More(); {
+		resp := &workResponse{}
+		if err := dec.Decode(resp); err != nil {
+			t.Fatal(err)
+		}
+		resps = append(resps, resp)
+	}
+	checkResponses(t, reqs, resps)
+}
+
+func TestWorkerProto(t *testing.T) {
+	reqs := readRecordedRequests(t)
+	in := &bytes.Buffer{}
+	for _, req := range reqs {
+		msg := encodeWorkRequest(req)
+		var buf [binary.MaxVarintLen64]byte
+		in.Write(buf[:binary.PutUvarint(buf[:], uint64(len(msg)))])
+		in.Write(msg)
+	}
+	out := &bytes.Buffer{}
+	codec := &protoWorkCodec{r: bufio.NewReader(in), w: out}
+	if err := runWorker(codec, fakeBuilder); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(out)
+	var resps []*workResponse
+	for {
+		size, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		msg := make([]byte, size)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := decodeWorkResponse(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resps = append(resps, resp)
+	}
+	checkResponses(t, reqs, resps)
+}
+
+func TestWorkerBuildTags(t *testing.T) {
+	// tagBuilder parses -tags like the real builders, which add the tags to
+	// build.Default, then prints the tags in effect.
+	tagBuilder := func(args []string) error {
+		flags := flag.NewFlagSet("builder", flag.ContinueOnError)
+		flags.Var(&tagFlag{}, "tags", "")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		fmt.Printf("tags: %s\n", strings.Join(build.Default.BuildTags, ","))
+		return nil
+	}
+	reqs := []*workRequest{
+		{Arguments: []string{"-tags", "foo"}, RequestID: 1},
+		{Arguments: []string{"-tags", "bar"}, RequestID: 2},
+	}
+	in := &bytes.Buffer{}
+	enc := json.NewEncoder(in)
+	for _, req := range reqs {
+		if err := enc.Encode(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := &bytes.Buffer{}
+	codec := &jsonWorkCodec{dec: json.NewDecoder(in), enc: json.NewEncoder(out)}
+	origTags := strings.Join(build.Default.BuildTags, ",")
+	if err := runWorker(codec, tagBuilder); err != nil {
+		t.Fatal(err)
+	}
+
+	var outputs []string
+	for dec := json.NewDecoder(out); dec.More(); {
+		resp := &workResponse{}
+		if err := dec.Decode(resp); err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, resp.Output)
+	}
+	want := []string{"tags: foo\n", "tags: bar\n"}
+	if origTags != "" {
+		want = []string{"tags: " + origTags + ",foo\n", "tags: " + origTags + ",bar\n"}
+	}
+	if !reflect.DeepEqual(outputs, want) {
+		t.Errorf("got outputs %q; want %q", outputs, want)
+	}
+	if got := strings.Join(build.Default.BuildTags, ","); got != origTags {
+		t.Errorf("got build tags %q after requests; want %q", got, origTags)
+	}
+}
+
+func TestDecodeWorkRequestSkipsUnknownFields(t *testing.T) {
+	want := &workRequest{Arguments: []string{"-o", "foo.a"}, RequestID: 7}
+	var msg []byte
+	msg = appendProtoBytes(msg, workRequestArgumentsField, []byte("-o"))
+	// inputs, a nested message.
+	msg = appendProtoBytes(msg, 2, appendProtoBytes(nil, 1, []byte("foo.go")))
+	msg = appendProtoBytes(msg, workRequestArgumentsField, []byte("foo.a"))
+	msg = appendProtoVarint(msg, workRequestRequestIDField, 7)
+	// verbosity
+	msg = appendProtoVarint(msg, 5, 10)
+	got, err := decodeWorkRequest(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v; want %#v", got, want)
+	}
+}
+
+func TestExpandFlagFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestExpandFlagFiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	builderParams := filepath.Join(dir, "builder.params")
+	toolParams := filepath.Join(dir, "tool.params")
+	if err := ioutil.WriteFile(builderParams, []byte("-o\nfoo.a\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(toolParams, []byte("--\n-trimpath\n.\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	got, err := expandFlagFiles([]string{"@" + builderParams, "-v", "@" + toolParams})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"-o", "foo.a", "-v", "--", "-trimpath", "."}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+// encodeWorkRequest and decodeWorkResponse do what Bazel does on its side of
+// the protobuf protocol.
+
+func encodeWorkRequest(req *workRequest) []byte {
+	var msg []byte
+	for _, arg := range req.Arguments {
+		msg = appendProtoBytes(msg, workRequestArgumentsField, []byte(arg))
+	}
+	if req.RequestID != 0 {
+		msg = appendProtoVarint(msg, workRequestRequestIDField, uint64(int64(req.RequestID)))
+	}
+	return msg
+}
+
+func decodeWorkResponse(msg []byte) (*workResponse, error) {
+	resp := &workResponse{}
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return nil, errBadProto
+		}
+		msg = msg[n:]
+		field, wire := key>>3, key&7
+		switch wire {
+		case wireVarint:
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return nil, errBadProto
+			}
+			msg = msg[n:]
+			switch field {
+			case workResponseExitCodeField:
+				resp.ExitCode = int32(v)
+			case workResponseRequestIDField:
+				resp.RequestID = int32(v)
+			}
+		case wireBytes:
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < size {
+				return nil, errBadProto
+			}
+			if field == workResponseOutputField {
+				resp.Output = string(msg[n : n+int(size)])
+			}
+			msg = msg[n+int(size):]
+		default:
+			return nil, errBadProto
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,161 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bzltestutil
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// benchEnv is the environment variable that selects benchmarks to run, like
+// -test.bench. Bazel's --test_filter only selects tests.
+const benchEnv = "GO_TEST_BENCH"
+
+// FilterArgs returns arguments for the testing package that select the tests
+// named by Bazel's --test_filter, passed in TESTBRIDGE_TEST_ONLY, and the
+// benchmarks named by GO_TEST_BENCH. They should come before other
+// arguments, so flags set on the command line take precedence.
+//
+// Both filters are lists of patterns separated by commas. Each pattern is
+// a -test.run pattern: a regular expression for the name of a top-level
+// test, optionally followed by patterns for subtests, separated by slashes.
+// A test runs if it matches any pattern. Before go1.20, the testing package
+// can't express a list with more than one pattern if any of them has subtest
+// patterns, so FilterArgs returns an error for such a list.
+//
+// tests are the names of the tests, examples, and fuzz targets selected by
+// -test.run, and benchmarks are the names of the benchmarks. FilterArgs
+// returns a warning for each pattern that doesn't match any top-level name,
+// which is probably a mistake.
+func FilterArgs(tests, benchmarks []string) (args, warnings []string, err error) {
+	if filter := os.Getenv("TESTBRIDGE_TEST_ONLY"); filter != "" {
+		run, w, err := translateFilter("TESTBRIDGE_TEST_ONLY", filter, "test", tests)
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, "-test.run="+run)
+		warnings = append(warnings, w...)
+	}
+	if filter := os.Getenv(benchEnv); filter != "" {
+		bench, w, err := translateFilter(benchEnv, filter, "benchmark", benchmarks)
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, "-test.bench="+bench)
+		warnings = append(warnings, w...)
+	}
+	return args, warnings, nil
+}
+
+// subtestAlternation is whether the testing package matches each alternative
+// of a pattern separately, including its subtest patterns. This is true
+// starting with go1.20. Before that, a pattern is split at each slash first,
+// so "TestA/x|TestB" means tests matching "TestA" with subtests matching
+// "x|TestB". Tests override this.
+var subtestAlternation = goMinorAtLeast(runtime.Version(), 20)
+
+// translateFilter returns a pattern for the testing package equivalent to
+// filter, a list of patterns, and warnings for patterns that don't match any
+// of names. env is the name of the variable filter came from, and kind
+// describes the names in warnings.
+func translateFilter(env, filter, kind string, names []string) (string, []string, error) {
+	var patterns, warnings []string
+	hasSubtests := false
+	for _, pattern := range splitPattern(filter, ',') {
+		if pattern == "" {
+			continue
+		}
+		patterns = append(patterns, pattern)
+		parts := splitPattern(pattern, '/')
+		if len(parts) > 1 {
+			hasSubtests = true
+		}
+		if !matchesAny(parts[0], names) {
+			warnings = append(warnings, fmt.Sprintf("%s: %q does not match any %s", env, pattern, kind))
+		}
+	}
+	if len(patterns) > 1 && hasSubtests && !subtestAlternation {
+		return "", nil, fmt.Errorf("%s: %q: lists of more than one pattern can't include subtest patterns before go1.20", env, filter)
+	}
+	// Without subtest patterns, an alternation of top-level patterns has the
+	// same meaning in all versions.
+	return strings.Join(patterns, "|"), warnings, nil
+}
+
+// goMinorAtLeast reports whether version, a Go version reported by
+// runtime.Version, is go1.minor or newer. Versions that can't be parsed are
+// probably newer development versions.
+func goMinorAtLeast(version string, minor int) bool {
+	if !strings.HasPrefix(version, "go1.") {
+		return true
+	}
+	version = version[len("go1."):]
+	if i := strings.IndexFunc(version, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		version = version[:i]
+	}
+	n, err := strconv.Atoi(version)
+	return err != nil || n >= minor
+}
+
+// matchesAny reports whether pattern matches any of names. An invalid
+// pattern is considered to match, since the testing package reports it. So
+// is a pattern that matches the empty string, like "^$", which is commonly
+// used to run no tests on purpose.
+func matchesAny(pattern string, names []string) bool {
+	re, err := regexp.Compile(pattern)
+	if err != nil || re.MatchString("") {
+		return true
+	}
+	for _, name := range names {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPattern splits a regular expression at each occurrence of sep that
+// isn't escaped or inside brackets, parentheses, or braces.
+func splitPattern(s string, sep byte) []string {
+	var parts []string
+	depth, inClass, start := 0, false, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case inClass:
+			if c == ']' {
+				inClass = false
+			}
+		case c == '[':
+			inClass = true
+		case c == '(' || c == '{':
+			depth++
+		case c == ')' || c == '}':
+			if depth > 0 {
+				depth--
+			}
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
@@ -0,0 +1,148 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bzltestutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitPattern(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		sep  byte
+		want []string
+	}{
+		{"TestA", ',', []string{"TestA"}},
+		{"TestA,TestB/case_1", ',', []string{"TestA", "TestB/case_1"}},
+		{"TestA{1,2},Test[,]", ',', []string{"TestA{1,2}", "Test[,]"}},
+		{`TestA\,B,TestC`, ',', []string{`TestA\,B`, "TestC"}},
+		{"TestA/case_1/x", '/', []string{"TestA", "case_1", "x"}},
+		{"Test(A/B)/x", '/', []string{"Test(A/B)", "x"}},
+		{"TestA,", ',', []string{"TestA", ""}},
+	} {
+		if got := splitPattern(tc.s, tc.sep); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("splitPattern(%q, %q): got %q; want %q", tc.s, tc.sep, got, tc.want)
+		}
+	}
+}
+
+func TestFilterArgs(t *testing.T) {
+	tests := []string{"TestFoo", "TestBar", "ExampleFoo"}
+	benchmarks := []string{"BenchmarkFoo"}
+	for _, tc := range []struct {
+		desc, filter, bench string
+		oldGo               bool
+		wantArgs            []string
+		wantWarnings        int
+		wantErr             bool
+	}{
+		{
+			desc: "none",
+		}, {
+			desc:     "test",
+			filter:   "TestFoo",
+			wantArgs: []string{"-test.run=TestFoo"},
+		}, {
+			desc:     "subtest",
+			filter:   "TestFoo/case_1",
+			wantArgs: []string{"-test.run=TestFoo/case_1"},
+		}, {
+			desc:     "list",
+			filter:   "TestFoo/case_1,Bar$,",
+			wantArgs: []string{"-test.run=TestFoo/case_1|Bar$"},
+		}, {
+			desc:     "mixed_list",
+			filter:   "TestFoo/case_1,TestBar",
+			wantArgs: []string{"-test.run=TestFoo/case_1|TestBar"},
+		}, {
+			desc:    "mixed_list_old_go",
+			filter:  "TestFoo/case_1,TestBar",
+			oldGo:   true,
+			wantErr: true,
+		}, {
+			desc:     "top_level_list_old_go",
+			filter:   "TestFoo,Bar$",
+			oldGo:    true,
+			wantArgs: []string{"-test.run=TestFoo|Bar$"},
+		}, {
+			desc:     "subtest_old_go",
+			filter:   "TestFoo/case_1,",
+			oldGo:    true,
+			wantArgs: []string{"-test.run=TestFoo/case_1"},
+		}, {
+			desc:    "mixed_bench_list_old_go",
+			bench:   "BenchmarkFoo/small,BenchmarkFoo/large",
+			oldGo:   true,
+			wantErr: true,
+		}, {
+			desc:         "no_match",
+			filter:       "TestFoo,TestBaz/case_1",
+			wantArgs:     []string{"-test.run=TestFoo|TestBaz/case_1"},
+			wantWarnings: 1,
+		}, {
+			desc:     "bench",
+			filter:   "^$",
+			bench:    "Foo",
+			wantArgs: []string{"-test.run=^$", "-test.bench=Foo"},
+		}, {
+			desc:         "bench_no_match",
+			bench:        "BenchmarkBar",
+			wantArgs:     []string{"-test.bench=BenchmarkBar"},
+			wantWarnings: 1,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			defer setenv(t, "TESTBRIDGE_TEST_ONLY", tc.filter)()
+			defer setenv(t, benchEnv, tc.bench)()
+			defer func(v bool) { subtestAlternation = v }(subtestAlternation)
+			subtestAlternation = !tc.oldGo
+			args, warnings, err := FilterArgs(tests, benchmarks)
+			if err != nil {
+				if !tc.wantErr {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			} else if tc.wantErr {
+				t.Fatal("unexpected success")
+			}
+			if !reflect.DeepEqual(args, tc.wantArgs) {
+				t.Errorf("got args %q; want %q", args, tc.wantArgs)
+			}
+			if len(warnings) != tc.wantWarnings {
+				t.Errorf("got warnings %q; want %d", warnings, tc.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestGoMinorAtLeast(t *testing.T) {
+	for _, tc := range []struct {
+		version string
+		want    bool
+	}{
+		{"go1.11.5", false},
+		{"go1.19", false},
+		{"go1.20", true},
+		{"go1.21rc2", true},
+		{"go1.22.1 X:boringcrypto", true},
+		{"devel go1.23-abcdef", true},
+	} {
+		if got := goMinorAtLeast(tc.version, 20); got != tc.want {
+			t.Errorf("goMinorAtLeast(%q, 20): got %v; want %v", tc.version, got, tc.want)
+		}
+	}
+}
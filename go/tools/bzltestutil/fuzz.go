@@ -0,0 +1,182 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bzltestutil
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fuzzDirName is the name of the directory in TEST_TMPDIR where tests run
+// while fuzzing. The testing package writes new crashers to testdata/fuzz
+// below the working directory, and the runfiles directory may not be
+// writable.
+const fuzzDirName = "go_fuzz_rundir"
+
+// fuzzCorpusDir is the directory where the testing package reads seed
+// corpora and writes new crashers, relative to the working directory.
+const fuzzCorpusDir = "testdata/fuzz"
+
+// FuzzingEnabled reports whether args, the arguments of a test binary, set
+// -test.fuzz to a non-empty pattern. When this is false, fuzz targets only
+// run their seed corpora, like regular tests.
+func FuzzingEnabled(args []string) bool {
+	return testFlag(args, "test.fuzz") != ""
+}
+
+// SetupFuzzing prepares the test binary to fuzz the tests in rundir. It
+// returns the directory the tests should run in instead.
+//
+// When run by Bazel with TEST_UNDECLARED_OUTPUTS_DIR, this is a copy of
+// rundir in TEST_TMPDIR, made of symbolic links, except that testdata/fuzz
+// and its subdirectories are real directories. Wrap copies new crashers from
+// there to TEST_UNDECLARED_OUTPUTS_DIR when the test finishes. Otherwise,
+// the tests run in rundir.
+//
+// SetupFuzzing also sets -test.fuzzcachedir if it's not set, since the
+// testing package requires it, and makes the path to the binary absolute, so
+// fuzzing workers can be started after the directory changes. It must be
+// called before the working directory changes. It's called again in each
+// worker, which runs in the same directory.
+func SetupFuzzing(rundir string) (string, error) {
+	if !filepath.IsAbs(os.Args[0]) && strings.ContainsRune(os.Args[0], filepath.Separator) {
+		exe, err := filepath.Abs(os.Args[0])
+		if err != nil {
+			return "", err
+		}
+		os.Args[0] = exe
+	}
+
+	tmpDir := os.Getenv("TEST_TMPDIR")
+	if testFlag(os.Args[1:], "test.fuzzcachedir") == "" {
+		cacheDir := tmpDir
+		if cacheDir == "" {
+			cacheDir = os.TempDir()
+		}
+		cacheDir = filepath.Join(cacheDir, "go_fuzz_cache")
+		// Flags after the first non-flag argument aren't parsed, so this goes
+		// first.
+		os.Args = append([]string{os.Args[0], "-test.fuzzcachedir=" + cacheDir}, os.Args[1:]...)
+	}
+
+	fuzzDir, ok := fuzzRunDir()
+	if !ok {
+		return rundir, nil
+	}
+	if _, err := os.Stat(fuzzDir); err == nil {
+		// Created by the process that started this worker.
+		return fuzzDir, nil
+	}
+	if err := copyRunDir(rundir, fuzzDir, ""); err != nil {
+		return "", err
+	}
+	return fuzzDir, nil
+}
+
+// fuzzRunDir returns the directory in TEST_TMPDIR where tests run while
+// fuzzing. ok is false if tests run in their usual directory.
+func fuzzRunDir() (dir string, ok bool) {
+	tmpDir := os.Getenv("TEST_TMPDIR")
+	if tmpDir == "" || os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR") == "" {
+		return "", false
+	}
+	return filepath.Join(tmpDir, fuzzDirName), true
+}
+
+// copyRunDir makes dst a copy of src, where rel is the path of src relative
+// to the directory being copied. Files and directories are copied as
+// symbolic links, except for directories where the testing package may
+// write new crashers and their parents.
+func copyRunDir(src, dst, rel string) error {
+	if err := os.MkdirAll(dst, 0777); err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		srcPath := filepath.Join(src, e.Name())
+		dstPath := filepath.Join(dst, e.Name())
+		relPath := filepath.ToSlash(filepath.Join(rel, e.Name()))
+		if fi, err := os.Stat(srcPath); err == nil && fi.IsDir() && isCorpusDir(relPath) {
+			if err := copyRunDir(srcPath, dstPath, relPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.Symlink(srcPath, dstPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isCorpusDir reports whether rel is testdata/fuzz, one of its parents, or
+// one of its subdirectories, which hold the corpus of a fuzz target.
+func isCorpusDir(rel string) bool {
+	return strings.HasPrefix(fuzzCorpusDir+"/", rel+"/") ||
+		filepath.ToSlash(filepath.Dir(rel)) == fuzzCorpusDir
+}
+
+// saveCrashers copies files written to testdata/fuzz while fuzzing to
+// TEST_UNDECLARED_OUTPUTS_DIR, at the same path. Seed corpus files are
+// symbolic links, so they're not copied.
+func saveCrashers() error {
+	fuzzDir, ok := fuzzRunDir()
+	if !ok || !FuzzingEnabled(os.Args[1:]) {
+		return nil
+	}
+	corpusDir := filepath.Join(fuzzDir, filepath.FromSlash(fuzzCorpusDir))
+	outDir := filepath.Join(os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"), filepath.FromSlash(fuzzCorpusDir))
+	err := filepath.Walk(corpusDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(corpusDir, path)
+		if err != nil {
+			return err
+		}
+		return copyFile(path, filepath.Join(outDir, rel))
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+		return err
+	}
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
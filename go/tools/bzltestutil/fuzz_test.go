@@ -0,0 +1,123 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bzltestutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFuzzingEnabled(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want bool
+	}{
+		{nil, false},
+		{[]string{"-test.run=FuzzA"}, false},
+		{[]string{"-test.fuzz=FuzzA"}, true},
+		{[]string{"-test.fuzzworker", "-test.fuzz", "FuzzA"}, true},
+		{[]string{"-test.fuzzcachedir", "-test.fuzz=FuzzA"}, false},
+	} {
+		if got := FuzzingEnabled(tc.args); got != tc.want {
+			t.Errorf("FuzzingEnabled(%q): got %v; want %v", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestSetupFuzzing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSetupFuzzing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rundir := filepath.Join(dir, "rundir")
+	for _, name := range []string{
+		"data.txt",
+		"testdata/golden.txt",
+		"testdata/fuzz/FuzzA/seed",
+	} {
+		path := filepath.Join(rundir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(name), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tmpDir := filepath.Join(dir, "tmp")
+	outDir := filepath.Join(dir, "out")
+	defer setenv(t, "TEST_TMPDIR", tmpDir)()
+	defer setenv(t, "TEST_UNDECLARED_OUTPUTS_DIR", outDir)()
+	defer func(args []string) { os.Args = args }(os.Args)
+	os.Args = []string{"bin/foo_test", "-test.fuzz=FuzzA"}
+
+	fuzzDir, err := SetupFuzzing(rundir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(tmpDir, fuzzDirName); fuzzDir != want {
+		t.Errorf("got directory %s; want %s", fuzzDir, want)
+	}
+	if !filepath.IsAbs(os.Args[0]) {
+		t.Errorf("path to binary %s is not absolute", os.Args[0])
+	}
+	if got := testFlag(os.Args[1:], "test.fuzzcachedir"); got == "" {
+		t.Error("-test.fuzzcachedir not set")
+	}
+	for _, name := range []string{
+		"data.txt",
+		"testdata/golden.txt",
+		"testdata/fuzz/FuzzA/seed",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(fuzzDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Error(err)
+		} else if string(data) != name {
+			t.Errorf("%s: got %q; want %q", name, data, name)
+		}
+	}
+
+	// Write crashers the way the testing package does, including one for a
+	// target without a seed corpus.
+	for _, name := range []string{"FuzzA/crash", "FuzzB/crash"} {
+		path := filepath.Join(fuzzDir, "testdata", "fuzz", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(name), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := saveCrashers(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"FuzzA/crash", "FuzzB/crash"} {
+		data, err := ioutil.ReadFile(filepath.Join(outDir, "testdata", "fuzz", filepath.FromSlash(name)))
+		if err != nil {
+			t.Error(err)
+		} else if string(data) != name {
+			t.Errorf("%s: got %q; want %q", name, data, name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "testdata", "fuzz", "FuzzA", "seed")); !os.IsNotExist(err) {
+		t.Errorf("seed corpus file was copied: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(rundir, "testdata", "fuzz", "FuzzB")); !os.IsNotExist(err) {
+		t.Errorf("crasher was written to the original directory: %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bzltestutil
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// timingsFileName is the name of the file written to
+// TEST_UNDECLARED_OUTPUTS_DIR with the time taken by each top-level test in
+// a shard. Files from all shards may be merged and used as a timings file
+// in later runs.
+const timingsFileName = "go_test_timings.json"
+
+// InShard reports which of the named tests, examples, and benchmarks should
+// run in the current shard. If the test isn't sharded, all of them should run.
+//
+// timingsFile is a JSON object mapping test names to the number of seconds
+// they took in previous runs, or "" if there isn't one. Tests named in the
+// file are distributed so each shard takes about the same time, starting
+// with the slowest. Other tests are distributed round-robin. If the timings
+// can't be read, all tests are distributed round-robin, and the error is
+// returned with the result. The result is always valid.
+//
+// InShard also creates TEST_SHARD_STATUS_FILE to tell Bazel that sharding is
+// supported.
+func InShard(names []string, timingsFile string) ([]bool, error) {
+	in := make([]bool, len(names))
+	total, err := strconv.Atoi(os.Getenv("TEST_TOTAL_SHARDS"))
+	if err != nil || total <= 1 {
+		for i := range in {
+			in[i] = true
+		}
+		return in, nil
+	}
+	index, err := strconv.Atoi(os.Getenv("TEST_SHARD_INDEX"))
+	if err != nil || index < 0 {
+		for i := range in {
+			in[i] = true
+		}
+		return in, nil
+	}
+	var firstErr error
+	if statusFile := os.Getenv("TEST_SHARD_STATUS_FILE"); statusFile != "" {
+		firstErr = ioutil.WriteFile(statusFile, nil, 0666)
+	}
+
+	var timings map[string]float64
+	if timingsFile != "" {
+		timings, err = readTimings(timingsFile)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for i, shard := range assignShards(names, timings, total) {
+		in[i] = shard == index
+	}
+	return in, firstErr
+}
+
+// BenchmarksEnabled reports whether args, the arguments of a test binary,
+// set -test.bench to a non-empty pattern. Benchmarks only run when this is
+// true, so they're only sharded then.
+func BenchmarksEnabled(args []string) bool {
+	return testFlag(args, "test.bench") != ""
+}
+
+// testFlag returns the value of the named flag in args, the arguments of a
+// test binary, or "" if it's not set. This is called before the testing
+// package parses its flags, so args are parsed the same way package flag
+// would parse them.
+func testFlag(args []string, name string) string {
+	value := ""
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' {
+			break
+		}
+		n := strings.TrimPrefix(arg[1:], "-")
+		v, hasValue := "", false
+		if eq := strings.IndexByte(n, '='); eq >= 0 {
+			n, v, hasValue = n[:eq], n[eq+1:], true
+		}
+		if !hasValue && !isBoolFlag(n) && i+1 < len(args) {
+			i++
+			v = args[i]
+		}
+		if n == name {
+			value = v
+		}
+	}
+	return value
+}
+
+// testingBoolFlags are the boolean flags of the testing package. They may not
+// be registered yet when testFlag is called.
+var testingBoolFlags = map[string]bool{
+	"test.benchmem":     true,
+	"test.failfast":     true,
+	"test.fullpath":     true,
+	"test.fuzzworker":   true,
+	"test.paniconexit0": true,
+	"test.short":        true,
+	"test.v":            true,
+}
+
+func isBoolFlag(name string) bool {
+	if f := flag.Lookup(name); f != nil {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		return ok && b.IsBoolFlag()
+	}
+	return testingBoolFlags[name]
+}
+
+// assignShards returns the shard each named test runs in.
+func assignShards(names []string, timings map[string]float64, total int) []int {
+	shards := make([]int, len(names))
+	var known, unknown []int
+	for i, name := range names {
+		if _, ok := timings[name]; ok {
+			known = append(known, i)
+		} else {
+			unknown = append(unknown, i)
+		}
+	}
+
+	// Assign each test with a known cost to the shard with the least work so
+	// far, starting with the most expensive. The order only depends on names
+	// and timings, so every shard computes the same assignment.
+	sort.SliceStable(known, func(i, j int) bool {
+		return timings[names[known[i]]] > timings[names[known[j]]]
+	})
+	load := make([]float64, total)
+	for _, i := range known {
+		least := 0
+		for s := range load {
+			if load[s] < load[least] {
+				least = s
+			}
+		}
+		shards[i] = least
+		load[least] += timings[names[i]]
+	}
+	for n, i := range unknown {
+		shards[i] = n % total
+	}
+	return shards
+}
+
+func readTimings(path string) (map[string]float64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading test timings: %v", err)
+	}
+	var timings map[string]float64
+	if err := json.Unmarshal(data, &timings); err != nil {
+		return nil, fmt.Errorf("reading test timings from %s: %v", path, err)
+	}
+	return timings, nil
+}
+
+// writeTimings writes the time taken by each top-level test in results to
+// TEST_UNDECLARED_OUTPUTS_DIR, when the test is sharded.
+func writeTimings(results []*testResult) error {
+	dir := os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR")
+	if total, err := strconv.Atoi(os.Getenv("TEST_TOTAL_SHARDS")); dir == "" || err != nil || total <= 1 {
+		return nil
+	}
+	timings := make(map[string]float64)
+	for _, r := range results {
+		if r.state == "" || strings.Contains(r.name, "/") {
+			continue
+		}
+		timings[r.name] = r.elapsed.Seconds()
+	}
+	data, err := json.MarshalIndent(timings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, timingsFileName), data, 0666)
+}
@@ -0,0 +1,135 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bzltestutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAssignShards(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		names   []string
+		timings map[string]float64
+		total   int
+		want    []int
+	}{
+		{
+			desc:  "round_robin",
+			names: []string{"TestA", "TestB", "TestC", "TestD", "TestE"},
+			total: 2,
+			want:  []int{0, 1, 0, 1, 0},
+		}, {
+			desc:    "slowest_first",
+			names:   []string{"TestA", "TestB", "TestC", "TestD"},
+			timings: map[string]float64{"TestA": 1, "TestB": 10, "TestC": 4, "TestD": 5},
+			total:   2,
+			// TestB is alone in shard 0, and the rest fill shard 1.
+			want: []int{1, 0, 1, 1},
+		}, {
+			desc:    "unknown",
+			names:   []string{"TestA", "TestNew1", "TestB", "TestNew2", "TestNew3"},
+			timings: map[string]float64{"TestA": 3, "TestB": 2},
+			total:   2,
+			want:    []int{0, 0, 1, 1, 0},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := assignShards(tc.names, tc.timings, tc.total); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInShard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestInShard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	timingsPath := filepath.Join(dir, "timings.json")
+	if err := ioutil.WriteFile(timingsPath, []byte(`{"TestA": 10, "TestB": 1, "TestC": 1}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	statusPath := filepath.Join(dir, "status")
+	defer setenv(t, "TEST_TOTAL_SHARDS", "2")()
+	defer setenv(t, "TEST_SHARD_INDEX", "1")()
+	defer setenv(t, "TEST_SHARD_STATUS_FILE", statusPath)()
+
+	names := []string{"TestA", "TestB", "TestC"}
+	in, err := InShard(names, timingsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []bool{false, true, true}; !reflect.DeepEqual(in, want) {
+		t.Errorf("got %v; want %v", in, want)
+	}
+	if _, err := os.Stat(statusPath); err != nil {
+		t.Errorf("status file not written: %v", err)
+	}
+
+	// Tests are still sharded round-robin if the timings can't be read.
+	in, err = InShard(names, filepath.Join(dir, "missing.json"))
+	if err == nil {
+		t.Error("unexpected success reading missing timings")
+	}
+	if want := []bool{false, true, false}; !reflect.DeepEqual(in, want) {
+		t.Errorf("got %v; want %v", in, want)
+	}
+}
+
+func TestBenchmarksEnabled(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want bool
+	}{
+		{nil, false},
+		{[]string{"-test.v"}, false},
+		{[]string{"-test.bench=."}, true},
+		{[]string{"--test.bench", "."}, true},
+		{[]string{"-test.v", "-test.run", "TestA", "-test.bench", "BenchmarkA"}, true},
+		{[]string{"-test.bench=.", "-test.bench="}, false},
+		{[]string{"-test.run", "-test.bench=."}, false},
+		{[]string{"arg", "-test.bench=."}, false},
+		{[]string{"--", "-test.bench=."}, false},
+	} {
+		if got := BenchmarksEnabled(tc.args); got != tc.want {
+			t.Errorf("BenchmarksEnabled(%q): got %v; want %v", tc.args, got, tc.want)
+		}
+	}
+}
+
+// setenv sets the environment variable key to value and returns a function
+// that restores its previous value, or unsets it if it wasn't set. Tests
+// call it with defer, so each test or subtest restores what it changes.
+func setenv(t *testing.T, key, value string) func() {
+	old, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bzltestutil
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// testResult is the outcome of a test, subtest, or example, collected from
+// the verbose output of a test binary.
+type testResult struct {
+	name string
+
+	// state is "pass", "fail", or "skip", or "" if the test started but its
+	// result wasn't printed, for example because the binary panicked.
+	state string
+
+	// elapsed is the time reported on the result line.
+	elapsed time.Duration
+
+	// output is everything printed while the test was running, and any
+	// messages logged with the result.
+	output strings.Builder
+}
+
+// converter reconstructs test results from -test.v output, the same
+// information cmd/test2json extracts. Lines are attributed to the test named
+// in the most recent "=== RUN", "=== CONT", "=== NAME", or "--- " line.
+type converter struct {
+	results []*testResult
+	byName  map[string]*testResult
+	current *testResult
+}
+
+func newConverter() *converter {
+	return &converter{byName: make(map[string]*testResult)}
+}
+
+var resultStates = map[string]string{
+	"--- PASS: ": "pass",
+	"--- FAIL: ": "fail",
+	"--- SKIP: ": "skip",
+}
+
+// line processes a line of output, including its trailing newline if any.
+func (c *converter) line(line string) {
+	trimmed := strings.TrimRight(line, "\r\n")
+	for _, prefix := range []string{"=== RUN   ", "=== CONT  ", "=== NAME  ", "=== PAUSE "} {
+		if strings.HasPrefix(trimmed, prefix) {
+			name := strings.TrimSpace(trimmed[len(prefix):])
+			if prefix == "=== PAUSE " || name == "" {
+				// Output after "=== NAME" without a name doesn't belong to
+				// any test, like the progress of the fuzzing engine.
+				c.current = nil
+			} else {
+				c.current = c.result(name)
+			}
+			return
+		}
+	}
+
+	// Result lines of subtests are indented by four spaces per level.
+	indented := strings.TrimLeft(trimmed, " ")
+	for prefix, state := range resultStates {
+		if !strings.HasPrefix(indented, prefix) {
+			continue
+		}
+		name, elapsed := parseResult(indented[len(prefix):])
+		r := c.result(name)
+		r.state = state
+		r.elapsed = elapsed
+		c.current = r
+		return
+	}
+
+	switch trimmed {
+	case "PASS", "FAIL":
+		// Summary printed after all tests have run.
+		c.current = nil
+		return
+	}
+	if c.current != nil {
+		c.current.output.WriteString(line)
+	}
+}
+
+// result returns the result for the test with the given name, creating it
+// if the test hasn't been seen before.
+func (c *converter) result(name string) *testResult {
+	if r, ok := c.byName[name]; ok {
+		return r
+	}
+	r := &testResult{name: name}
+	c.byName[name] = r
+	c.results = append(c.results, r)
+	return r
+}
+
+// parseResult splits the rest of a result line like "TestFoo (0.01s)" into
+// the test name and the elapsed time.
+func parseResult(s string) (string, time.Duration) {
+	i := strings.LastIndex(s, " (")
+	if i < 0 || !strings.HasSuffix(s, "s)") {
+		return s, 0
+	}
+	secs, err := strconv.ParseFloat(s[i+len(" ("):len(s)-len("s)")], 64)
+	if err != nil {
+		return s, 0
+	}
+	return s[:i], time.Duration(secs * float64(time.Second))
+}
@@ -0,0 +1,123 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bzltestutil provides support for Bazel's test protocol in the main
+// packages generated for go_test.
+//
+// This package is part of the Bazel Go rules, and its interface
+// should not be considered public. It may change without notice.
+package bzltestutil
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// wrappedEnv is set in the environment of a test binary run by Wrap, so it
+// doesn't wrap itself again.
+const wrappedEnv = "GO_TEST_WRAPPED"
+
+// wrapEnv is the environment variable that controls Wrap. Setting it to a
+// false value turns wrapping off, and setting it to a true value turns it on
+// even when Bazel doesn't ask for a test report.
+const wrapEnv = "GO_TEST_WRAP"
+
+// ShouldWrap reports whether the test binary should run itself with Wrap.
+// This is true when Bazel asks for a test report by setting XML_OUTPUT_FILE,
+// unless GO_TEST_WRAP is set to a false value, and when GO_TEST_WRAP is set
+// to a true value. It's always true when fuzzing, since new crashers are
+// saved by Wrap. It's false if the binary is already wrapped.
+func ShouldWrap() bool {
+	if os.Getenv(wrappedEnv) != "" {
+		return false
+	}
+	if FuzzingEnabled(os.Args[1:]) {
+		return true
+	}
+	if wrap, err := strconv.ParseBool(os.Getenv(wrapEnv)); err == nil {
+		return wrap
+	}
+	return os.Getenv("XML_OUTPUT_FILE") != ""
+}
+
+// Wrap runs the test binary again in a subprocess with -test.v and the same
+// arguments, copying its output to stdout. If Bazel asks for a test report,
+// it writes a JUnit XML report of the tests that ran to XML_OUTPUT_FILE, with
+// pkg as the name of the test suite. When the test is sharded, it also
+// writes the time each test took to TEST_UNDECLARED_OUTPUTS_DIR, for use as a
+// timings file by InShard. When fuzzing, it copies new crashers there too.
+// These are written even if the tests fail, in which case Wrap returns an
+// *exec.ExitError.
+//
+// The subprocess is used so the report is written even if a test panics or
+// calls os.Exit. Wrap must be called before the working directory changes.
+func Wrap(pkg string) error {
+	// -test.v comes first, since arguments after the first non-flag argument
+	// are passed to the test instead of being parsed by the testing package.
+	args := append([]string{"-test.v"}, os.Args[1:]...)
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), wrappedEnv+"=1")
+	cmd.Stdin = os.Stdin
+	pr, pw := io.Pipe()
+	out := io.MultiWriter(os.Stdout, pw)
+	cmd.Stdout, cmd.Stderr = out, out
+
+	conv := newConverter()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r := bufio.NewReader(pr)
+		for {
+			line, err := r.ReadString('\n')
+			if line != "" {
+				conv.line(line)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	runErr := cmd.Run()
+	elapsed := time.Since(start)
+	pw.Close()
+	<-done
+	if _, ok := runErr.(*exec.ExitError); runErr != nil && !ok {
+		return runErr
+	}
+
+	if xmlFile := os.Getenv("XML_OUTPUT_FILE"); xmlFile != "" {
+		data, err := junitXML(pkg, conv.results, elapsed)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(xmlFile, data, 0666); err != nil {
+			return err
+		}
+	}
+	if err := writeTimings(conv.results); err != nil {
+		return err
+	}
+	if err := saveCrashers(); err != nil {
+		return err
+	}
+	return runErr
+}
@@ -0,0 +1,47 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bzltestutil
+
+import (
+	"os"
+	"testing"
+)
+
+func TestShouldWrap(t *testing.T) {
+	defer func(args []string) { os.Args = args }(os.Args)
+	for _, tc := range []struct {
+		desc, wrap, xml, wrapped string
+		args                     []string
+		want                     bool
+	}{
+		{desc: "default", want: false},
+		{desc: "report", xml: "test.xml", want: true},
+		{desc: "opt out", xml: "test.xml", wrap: "0", want: false},
+		{desc: "opt in", wrap: "1", want: true},
+		{desc: "fuzzing", wrap: "0", args: []string{"-test.fuzz=FuzzA"}, want: true},
+		{desc: "wrapped", xml: "test.xml", wrapped: "1", want: false},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			defer setenv(t, wrapEnv, tc.wrap)()
+			defer setenv(t, "XML_OUTPUT_FILE", tc.xml)()
+			defer setenv(t, wrappedEnv, tc.wrapped)()
+			os.Args = append([]string{"bin/foo_test"}, tc.args...)
+			if got := ShouldWrap(); got != tc.want {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bzltestutil
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type xmlTestSuites struct {
+	XMLName xml.Name       `xml:"testsuites"`
+	Suites  []xmlTestSuite `xml:"testsuite"`
+}
+
+type xmlTestSuite struct {
+	XMLName   xml.Name      `xml:"testsuite"`
+	TestCases []xmlTestCase `xml:"testcase"`
+	Errors    int           `xml:"errors,attr"`
+	Failures  int           `xml:"failures,attr"`
+	Skipped   int           `xml:"skipped,attr"`
+	Tests     int           `xml:"tests,attr"`
+	Time      string        `xml:"time,attr"`
+	Name      string        `xml:"name,attr"`
+}
+
+type xmlTestCase struct {
+	XMLName   xml.Name    `xml:"testcase"`
+	Classname string      `xml:"classname,attr"`
+	Name      string      `xml:"name,attr"`
+	Time      string      `xml:"time,attr"`
+	Failure   *xmlMessage `xml:"failure,omitempty"`
+	Error     *xmlMessage `xml:"error,omitempty"`
+	Skipped   *xmlMessage `xml:"skipped,omitempty"`
+	SystemOut string      `xml:"system-out,omitempty"`
+}
+
+type xmlMessage struct {
+	Message  string `xml:"message,attr"`
+	Type     string `xml:"type,attr"`
+	Contents string `xml:",chardata"`
+}
+
+// junitXML returns a JUnit XML document describing results. There is one
+// test case for each test, subtest, and example. pkg is the name of the test
+// suite, and elapsed is the time taken by the whole test binary.
+func junitXML(pkg string, results []*testResult, elapsed time.Duration) ([]byte, error) {
+	suite := xmlTestSuite{
+		Name: pkg,
+		Time: formatSeconds(elapsed),
+	}
+	for _, r := range results {
+		tc := xmlTestCase{
+			Classname: pkg,
+			Name:      r.name,
+			Time:      formatSeconds(r.elapsed),
+		}
+		output := r.output.String()
+		switch r.state {
+		case "pass":
+			tc.SystemOut = output
+		case "fail":
+			suite.Failures++
+			tc.Failure = &xmlMessage{Message: "Failed", Contents: output}
+		case "skip":
+			suite.Skipped++
+			tc.Skipped = &xmlMessage{Message: skipReason(output), Contents: output}
+		default:
+			suite.Errors++
+			tc.Error = &xmlMessage{Message: "No pass/skip/fail result found for test", Contents: output}
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	suite.Tests = len(suite.TestCases)
+
+	data, err := xml.MarshalIndent(&xmlTestSuites{Suites: []xmlTestSuite{suite}}, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// skipReason returns the message passed to t.Skip. This is the last line
+// the test logged, prefixed by the file and line.
+func skipReason(output string) string {
+	lines := strings.Split(output, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		if j := strings.Index(line, ": "); j >= 0 && strings.Contains(line[:j], ".go:") {
+			line = line[j+len(": "):]
+		}
+		return line
+	}
+	return ""
+}
+
+func formatSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
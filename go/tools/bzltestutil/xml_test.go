@@ -0,0 +1,101 @@
+/* Copyright 2019 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bzltestutil
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const verboseOutput = `=== RUN   TestPass
+--- PASS: TestPass (0.25s)
+=== RUN   TestFail
+    foo_test.go:10: got 1; want 2
+--- FAIL: TestFail (0.00s)
+=== RUN   TestSkip
+    foo_test.go:14: not supported on this platform
+--- SKIP: TestSkip (0.00s)
+=== NAME  
+fuzz: elapsed: 0s, gathering baseline coverage: 0/2 completed
+=== RUN   TestSub
+=== RUN   TestSub/a
+=== PAUSE TestSub/a
+=== RUN   TestSub/b
+    foo_test.go:20: b failed
+=== CONT  TestSub/a
+    foo_test.go:18: a ran
+--- FAIL: TestSub (1.50s)
+    --- FAIL: TestSub/b (0.00s)
+    --- PASS: TestSub/a (1.50s)
+=== RUN   TestPanic
+panic: oops
+`
+
+func TestConverter(t *testing.T) {
+	c := newConverter()
+	for _, line := range strings.SplitAfter(verboseOutput, "\n") {
+		c.line(line)
+	}
+
+	type result struct {
+		name, state string
+		elapsed     time.Duration
+		output      string
+	}
+	want := []result{
+		{"TestPass", "pass", 250 * time.Millisecond, ""},
+		{"TestFail", "fail", 0, "    foo_test.go:10: got 1; want 2\n"},
+		{"TestSkip", "skip", 0, "    foo_test.go:14: not supported on this platform\n"},
+		{"TestSub", "fail", 1500 * time.Millisecond, ""},
+		{"TestSub/a", "pass", 1500 * time.Millisecond, "    foo_test.go:18: a ran\n"},
+		{"TestSub/b", "fail", 0, "    foo_test.go:20: b failed\n"},
+		{"TestPanic", "", 0, "panic: oops\n"},
+	}
+	if len(c.results) != len(want) {
+		t.Fatalf("got %d results; want %d", len(c.results), len(want))
+	}
+	for i, r := range c.results {
+		got := result{r.name, r.state, r.elapsed, r.output.String()}
+		if got != want[i] {
+			t.Errorf("result %d: got %+v; want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestJUnitXML(t *testing.T) {
+	c := newConverter()
+	for _, line := range strings.SplitAfter(verboseOutput, "\n") {
+		c.line(line)
+	}
+	data, err := junitXML("example.com/foo", c.results, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	for _, want := range []string{
+		`<testsuite errors="1" failures="3" skipped="1" tests="7" time="2.000" name="example.com/foo">`,
+		`<testcase classname="example.com/foo" name="TestPass" time="0.250"></testcase>`,
+		`<failure message="Failed" type="">    foo_test.go:10: got 1; want 2&#xA;</failure>`,
+		`<skipped message="not supported on this platform" type="">`,
+		`<testcase classname="example.com/foo" name="TestSub/a" time="1.500">`,
+		`<error message="No pass/skip/fail result found for test" type="">panic: oops&#xA;</error>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("XML does not contain %s; got:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+package asm_defines
+
+// goos and goamd64v1 are implemented in assembly. They return values that
+// depend on which GOOS_ and GOAMD64_ macros are defined.
+func goos() int
+func goamd64v1() bool
@@ -0,0 +1,30 @@
+#include "textflag.h"
+
+// Functions are only defined if GOARCH_amd64 is defined, so the test doesn't
+// link otherwise.
+#ifdef GOARCH_amd64
+
+// func goos() int
+TEXT ·goos(SB),NOSPLIT,$0-8
+	MOVQ	$0, AX
+#ifdef GOOS_linux
+	MOVQ	$1, AX
+#endif
+#ifdef GOOS_darwin
+	MOVQ	$2, AX
+#endif
+#ifdef GOOS_windows
+	MOVQ	$3, AX
+#endif
+	MOVQ	AX, ret+0(FP)
+	RET
+
+// func goamd64v1() bool
+TEXT ·goamd64v1(SB),NOSPLIT,$0-1
+	MOVB	$0, ret+0(FP)
+#ifdef GOAMD64_v1
+	MOVB	$1, ret+0(FP)
+#endif
+	RET
+
+#endif
@@ -0,0 +1,22 @@
+package asm_defines
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGOOS(t *testing.T) {
+	want, ok := map[string]int{"linux": 1, "darwin": 2, "windows": 3}[runtime.GOOS]
+	if !ok {
+		t.Skipf("no code for GOOS %s", runtime.GOOS)
+	}
+	if got := goos(); got != want {
+		t.Errorf("got %d from assembly for GOOS %s; want %d", got, runtime.GOOS, want)
+	}
+}
+
+func TestGOAMD64(t *testing.T) {
+	if !goamd64v1() {
+		t.Error("GOAMD64_v1 is not defined in assembly")
+	}
+}
@@ -0,0 +1,13 @@
+package asm_header_offsets
+
+// answer and point are described in go_asm.h, which the compiler writes for
+// the assembly files in the same package.
+const answer = 42
+
+type point struct {
+	x, y int64
+}
+
+// These are implemented in assembly using definitions from go_asm.h.
+func getAnswer() int64
+func getY(p *point) int64
@@ -0,0 +1,16 @@
+package asm_header_offsets
+
+import "testing"
+
+func TestConst(t *testing.T) {
+	if got := getAnswer(); got != answer {
+		t.Errorf("got %d from assembly; want %d", got, answer)
+	}
+}
+
+func TestFieldOffset(t *testing.T) {
+	p := &point{x: 1, y: 2}
+	if got := getY(p); got != p.y {
+		t.Errorf("got %d from assembly; want %d", got, p.y)
+	}
+}
@@ -0,0 +1,14 @@
+// +build go1.16
+
+package embedsrcs
+
+import "embed"
+
+//go:embed embedsrcs_data/hello.txt
+var Hello string
+
+//go:embed embedsrcs_data/sub
+var Sub embed.FS
+
+//go:embed embedsrcs_gen.txt
+var Gen []byte
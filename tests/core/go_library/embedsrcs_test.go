@@ -0,0 +1,42 @@
+// +build go1.16
+
+package embedsrcs
+
+import (
+	"io/fs"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	if want := "hello\n"; Hello != want {
+		t.Errorf("Hello: got %q; want %q", Hello, want)
+	}
+}
+
+func TestGenerated(t *testing.T) {
+	if got, want := string(Gen), "generated\n"; got != want {
+		t.Errorf("Gen: got %q; want %q", got, want)
+	}
+}
+
+func TestDir(t *testing.T) {
+	var files []string
+	err := fs.WalkDir(Sub, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Hidden files are only embedded when they're named explicitly or the
+	// pattern starts with "all:".
+	want := []string{"embedsrcs_data/sub/sub.txt"}
+	if len(files) != len(want) || files[0] != want[0] {
+		t.Errorf("got files %q; want %q", files, want)
+	}
+}
@@ -0,0 +1,5 @@
+package a
+
+import "../b"
+
+var X = b.X
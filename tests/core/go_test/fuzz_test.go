@@ -0,0 +1,33 @@
+// +build go1.18
+
+package fuzz
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+)
+
+var seen = map[string]bool{}
+
+func FuzzSeedCorpus(f *testing.F) {
+	f.Add("from f.Add")
+	f.Fuzz(func(t *testing.T, s string) {
+		seen[s] = true
+	})
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if code == 0 && (!seen["from f.Add"] || !seen["from file"]) {
+		var got []string
+		for s := range seen {
+			got = append(got, s)
+		}
+		sort.Strings(got)
+		fmt.Fprintf(os.Stderr, "seed corpus did not run; got inputs %q\n", got)
+		code = 1
+	}
+	os.Exit(code)
+}
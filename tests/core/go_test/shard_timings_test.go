@@ -0,0 +1,38 @@
+package shard_timings
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// checkShard checks that a test runs in the shard it's assigned to based on
+// shard_timings.json.
+func checkShard(t *testing.T, want string) {
+	if got := os.Getenv("TEST_SHARD_INDEX"); got != want {
+		t.Errorf("got shard %s; want %s", got, want)
+	}
+}
+
+func TestSlow(t *testing.T) {
+	checkShard(t, "0")
+}
+
+func TestFast1(t *testing.T) {
+	checkShard(t, "1")
+}
+
+func TestFast2(t *testing.T) {
+	checkShard(t, "1")
+}
+
+func TestUnknown(t *testing.T) {
+	checkShard(t, "0")
+}
+
+// Examples are distributed together with tests. This is the second test
+// without timings, so it runs in the second shard.
+func Example_shard() {
+	fmt.Println(os.Getenv("TEST_SHARD_INDEX"))
+	// Output: 1
+}
@@ -12,7 +12,7 @@ import (
 const doc = `report calls of functions named "Foo"
 
 The foofuncname analyzer reports calls to functions that are
-named "Foo".`
+named "Foo". A different name may be set with the -name flag.`
 
 var Analyzer = &analysis.Analyzer{
 	Name: "foofuncname",
@@ -20,6 +20,12 @@ var Analyzer = &analysis.Analyzer{
 	Doc:  doc,
 }
 
+var name string
+
+func init() {
+	Analyzer.Flags.StringVar(&name, "name", "Foo", "name of functions to report")
+}
+
 func run(pass *analysis.Pass) (interface{}, error) {
 	for _, f := range pass.Files {
 		// TODO(samueltan): use package inspector once the latest golang.org/x/tools
@@ -27,8 +33,8 @@ func run(pass *analysis.Pass) (interface{}, error) {
 		ast.Inspect(f, func(n ast.Node) bool {
 			switch n := n.(type) {
 			case *ast.FuncDecl:
-				if n.Name.Name == "Foo" {
-					pass.Reportf(n.Pos(), "function must not be named Foo")
+				if n.Name.Name == name {
+					pass.Reportf(n.Pos(), "function must not be named %s", name)
 				}
 				return true
 			}
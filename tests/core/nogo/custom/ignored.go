@@ -0,0 +1,17 @@
+// package ignored contains analyzer errors that are suppressed with
+// nogo:ignore comments.
+package ignored
+
+import (
+	_ "fmt" //nogo:ignore importfmt testing suppression on a line
+
+	"dep"
+)
+
+// Foo is documented.
+//
+//nogo:ignore foofuncname,visibility testing suppression in a declaration
+func Foo() bool {
+	dep.D()
+	return true
+}
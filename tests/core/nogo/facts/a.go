@@ -0,0 +1,8 @@
+package a
+
+import "os"
+
+// Die exits the program, which the exits analyzer records as a fact.
+func Die() {
+	os.Exit(1)
+}
@@ -0,0 +1,7 @@
+package b
+
+import "facts/a"
+
+func Fail() {
+	a.Die()
+}
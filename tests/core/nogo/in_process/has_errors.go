@@ -0,0 +1,7 @@
+package haserrors
+
+import "fmt"
+
+func F() {
+	fmt.Println("hello")
+}
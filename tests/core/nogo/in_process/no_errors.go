@@ -0,0 +1,7 @@
+package noerrors
+
+import "strings"
+
+func F() string {
+	return strings.ToUpper("hello")
+}
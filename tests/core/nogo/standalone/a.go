@@ -0,0 +1,7 @@
+package a
+
+import "os"
+
+func Die() {
+	os.Exit(1)
+}
@@ -0,0 +1,7 @@
+package b
+
+import "example.com/a"
+
+func Fail() {
+	a.Die()
+}
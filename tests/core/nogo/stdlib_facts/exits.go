@@ -0,0 +1,71 @@
+// Package exits defines an analyzer that reports calls to functions that
+// exit the program by calling os.Exit, directly or through other functions.
+// Functions that exit are recorded as facts, so calls to standard library
+// functions like log.Fatal are only reported when facts are computed for the
+// standard library.
+package exits
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name:      "exits",
+	Doc:       "reports calls to functions that exit the program",
+	Run:       run,
+	FactTypes: []analysis.Fact{new(exitsFact)},
+}
+
+// exitsFact is exported for functions that exit the program.
+type exitsFact struct{}
+
+func (*exitsFact) AFact()         {}
+func (*exitsFact) String() string { return "exits" }
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	for _, f := range pass.Files {
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				callee := calledFunc(pass.TypesInfo, call)
+				if callee == nil || !(isOSExit(callee) || pass.ImportObjectFact(callee, new(exitsFact))) {
+					return true
+				}
+				pass.Reportf(call.Pos(), "call to %s.%s exits the program", callee.Pkg().Name(), callee.Name())
+				if obj := pass.TypesInfo.Defs[fn.Name]; obj != nil {
+					pass.ExportObjectFact(obj, new(exitsFact))
+				}
+				return true
+			})
+		}
+	}
+	return nil, nil
+}
+
+func calledFunc(info *types.Info, call *ast.CallExpr) *types.Func {
+	var id *ast.Ident
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		id = fun
+	case *ast.SelectorExpr:
+		id = fun.Sel
+	default:
+		return nil
+	}
+	fn, _ := info.Uses[id].(*types.Func)
+	return fn
+}
+
+func isOSExit(fn *types.Func) bool {
+	return fn.Pkg() != nil && fn.Pkg().Path() == "os" && fn.Name() == "Exit"
+}
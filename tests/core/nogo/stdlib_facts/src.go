@@ -0,0 +1,7 @@
+package src
+
+import "log"
+
+func Fail() {
+	log.Fatal("failed")
+}
@@ -0,0 +1,8 @@
+package a
+
+import (
+	"strict_deps/b"
+	"strict_deps/c"
+)
+
+var X = b.X + c.X
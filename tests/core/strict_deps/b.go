@@ -0,0 +1,5 @@
+package b
+
+import "strict_deps/c"
+
+var X = c.X
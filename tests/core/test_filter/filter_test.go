@@ -0,0 +1,41 @@
+package filter
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestPass(t *testing.T) {}
+
+func TestOtherPass(t *testing.T) {}
+
+func TestFail(t *testing.T) {
+	t.Fatal("TestFail should be filtered out")
+}
+
+func TestSub(t *testing.T) {
+	t.Run("case_1", func(t *testing.T) {})
+	t.Run("case_2", func(t *testing.T) {
+		t.Fatal("TestSub/case_2 should be filtered out")
+	})
+}
+
+var benchmarked bool
+
+func BenchmarkMarker(b *testing.B) {
+	benchmarked = true
+}
+
+func BenchmarkFail(b *testing.B) {
+	b.Fatal("BenchmarkFail should be filtered out")
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if code == 0 && os.Getenv("WANT_BENCHMARK") != "" && !benchmarked {
+		fmt.Fprintln(os.Stderr, "BenchmarkMarker did not run")
+		code = 1
+	}
+	os.Exit(code)
+}
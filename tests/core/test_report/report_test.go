@@ -0,0 +1,32 @@
+package report
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPass(t *testing.T) {
+	t.Log("passing")
+}
+
+func TestFail(t *testing.T) {
+	t.Error("failing")
+}
+
+func TestSkip(t *testing.T) {
+	t.Skip("not supported")
+}
+
+func TestSub(t *testing.T) {
+	t.Run("a", func(t *testing.T) {
+		t.Parallel()
+	})
+	t.Run("b", func(t *testing.T) {
+		t.Parallel()
+	})
+}
+
+func ExampleHello() {
+	fmt.Println("hello")
+	// Output: hello
+}
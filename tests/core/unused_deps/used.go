@@ -0,0 +1,7 @@
+package used
+
+import "unused_deps/dep"
+
+func Used() {
+	dep.Dep()
+}